@@ -0,0 +1,320 @@
+package gomm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CacheDir is the directory of the cache used by `GetMatrix` and
+// `GetComplexMatrix`. When empty, `DefaultCacheDir` is used.
+var CacheDir string
+
+// DefaultCacheDir returns the default cache directory, `gomm` within the
+// user's cache directory, e.g. `$XDG_CACHE_HOME/gomm` or `~/.cache/gomm` on
+// Linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gomm"), nil
+}
+
+// manifestFile is the name of the manifest within the cache directory.
+const manifestFile = "manifest.json"
+
+// manifestMu serializes the updates of the manifests.
+var manifestMu sync.Mutex
+
+// Cache stores downloaded matrices on disk, keyed by their collection, set,
+// and name, as `<dir>/<collection>/<set>/<name>.mtx.gz`. Matrices are only
+// downloaded when absent from the cache. The size and SHA-256 checksum of each
+// download are recorded in the manifest `<dir>/manifest.json`, and cached
+// matrices are verified against these before reuse. Matrices are downloaded
+// by the `Fetcher`, or by the `DefaultFetcher` when nil.
+type Cache struct {
+	Dir     string
+	Fetcher Fetcher
+}
+
+// ManifestEntry records the size and SHA-256 checksum of a downloaded matrix.
+type ManifestEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewCache returns the cache in the given directory, or in `DefaultCacheDir`
+// when empty. The directory is created on the first download.
+func NewCache(dir string) (*Cache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultCacheDir(); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{Dir: dir}, nil
+}
+
+// validKey verifies the collection, set, and name of the matrix form a path
+// within the cache.
+func validKey(matrix *Matrix) error {
+	for _, key := range []string{matrix.collection, matrix.set, matrix.name} {
+		if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+			return fmt.Errorf("Invalid cache key for matrix %v/%v/%v", matrix.collection, matrix.set, matrix.name)
+		}
+	}
+	return nil
+}
+
+// Path returns the path of the matrix within the cache.
+func (c *Cache) Path(matrix *Matrix) string {
+	return filepath.Join(c.Dir, matrix.collection, matrix.set, matrix.Filename())
+}
+
+// Has reports whether the matrix is present in the cache.
+func (c *Cache) Has(matrix *Matrix) bool {
+	if validKey(matrix) != nil {
+		return false
+	}
+	info, err := os.Stat(c.Path(matrix))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Fetch returns the path of the matrix within the cache, and downloads the
+// matrix when absent, or when it fails its verification, see `Verify`.
+// Downloads that are incomplete are reported as `ErrCorruptDownload`. See
+// `Client` to download with timeouts and retries.
+func (c *Cache) Fetch(matrix *Matrix) (string, error) {
+	fetcher := c.Fetcher
+	if fetcher == nil {
+		fetcher = DefaultFetcher
+	}
+	return c.fetch(matrix, func(path string) (ManifestEntry, error) {
+		return matrix.download(context.Background(), fetcher, path)
+	})
+}
+
+// fetch returns the path of the matrix within the cache, and downloads the
+// matrix to that path when absent or corrupt.
+func (c *Cache) fetch(matrix *Matrix, download func(path string) (ManifestEntry, error)) (string, error) {
+	if err := validKey(matrix); err != nil {
+		return "", err
+	}
+
+	path := c.Path(matrix)
+	if c.Has(matrix) {
+		err := c.Verify(matrix)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, ErrCorruptDownload) {
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	entry, err := download(path)
+	if err != nil {
+		return "", err
+	}
+	if err := c.record(matrix, &entry); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Verify verifies the cached matrix against the size and checksum recorded in
+// the manifest. Matrices that differ from the manifest, or are absent from it,
+// are reported as `ErrCorruptDownload`.
+func (c *Cache) Verify(matrix *Matrix) error {
+	if err := validKey(matrix); err != nil {
+		return err
+	}
+
+	manifest, err := c.Manifest()
+	if err != nil {
+		return err
+	}
+	exp, ok := manifest[manifestKey(matrix)]
+	if !ok {
+		return fmt.Errorf("%w: %v is absent from the manifest", ErrCorruptDownload, c.Path(matrix))
+	}
+
+	got, err := checksum(c.Path(matrix))
+	if err != nil {
+		return err
+	}
+	if got != exp {
+		return fmt.Errorf("%w: %v has size %d and SHA-256 %v, exp %d and %v",
+			ErrCorruptDownload, c.Path(matrix), got.Size, got.SHA256, exp.Size, exp.SHA256)
+	}
+	return nil
+}
+
+// manifestKey returns the key of the matrix in the manifest.
+func manifestKey(matrix *Matrix) string {
+	return matrix.collection + "/" + matrix.set + "/" + matrix.name
+}
+
+// Manifest returns the entries of the manifest, keyed by
+// `<collection>/<set>/<name>`. An absent manifest has no entries.
+func (c *Cache) Manifest() (map[string]ManifestEntry, error) {
+	manifest := make(map[string]ManifestEntry)
+	b, err := ioutil.ReadFile(filepath.Join(c.Dir, manifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("Invalid manifest %v: %w", filepath.Join(c.Dir, manifestFile), err)
+	}
+	return manifest, nil
+}
+
+// record records the entry of the matrix in the manifest, or removes the
+// matrix from the manifest for a nil entry.
+func (c *Cache) record(matrix *Matrix, entry *ManifestEntry) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	manifest, err := c.Manifest()
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		manifest[manifestKey(matrix)] = *entry
+	} else {
+		delete(manifest, manifestKey(matrix))
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	_, err = writeFile(filepath.Join(c.Dir, manifestFile), bytes.NewReader(b), int64(len(b)))
+	return err
+}
+
+// checksum returns the size and SHA-256 checksum of the file.
+func checksum(file string) (ManifestEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// List returns the matrices present in the cache, ordered by collection, set,
+// and name.
+func (c *Cache) List() ([]Matrix, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*", "*", "*.mtx.gz"))
+	if err != nil {
+		return nil, err
+	}
+
+	var matrices []Matrix
+	for _, file := range files {
+		set := filepath.Dir(file)
+		collection := filepath.Dir(set)
+		name := strings.TrimSuffix(filepath.Base(file), ".mtx.gz")
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		matrices = append(matrices, NewMatrix(filepath.Base(collection), filepath.Base(set), name))
+	}
+	return matrices, nil
+}
+
+// Remove removes the matrix from the cache and its manifest, if present.
+func (c *Cache) Remove(matrix *Matrix) error {
+	if err := validKey(matrix); err != nil {
+		return err
+	}
+	if err := os.Remove(c.Path(matrix)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := os.Stat(c.Dir); os.IsNotExist(err) {
+		return nil
+	}
+	return c.record(matrix, nil)
+}
+
+// Purge removes all matrices, the manifest, and the cache directory itself.
+func (c *Cache) Purge() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// writeFile writes the content of the reader to the file at the given path,
+// and returns its size and SHA-256 checksum. The content is written to a
+// temporary file in the same directory first, which is renamed once complete,
+// such that the file is either absent or complete, also while downloading
+// concurrently. Content that differs from the expected size, unless negative,
+// or that fails to decompress, is rejected as `ErrCorruptDownload`.
+func writeFile(path string, rd io.Reader, size int64) (ManifestEntry, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), rd)
+	if err != nil {
+		tmp.Close()
+		return ManifestEntry{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return ManifestEntry{}, err
+	}
+
+	entry := ManifestEntry{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+	if size >= 0 && n != size {
+		return entry, fmt.Errorf("%w: %v has %d bytes, exp %d", ErrCorruptDownload, path, n, size)
+	}
+	if err := checkDecompress(tmp.Name()); err != nil {
+		return entry, fmt.Errorf("%w: %v: %v", ErrCorruptDownload, path, err)
+	}
+	return entry, os.Rename(tmp.Name(), path)
+}
+
+// checkDecompress verifies the file decompresses completely, which detects
+// truncated compressed files.
+func checkDecompress(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rd, _, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, rd)
+	return err
+}
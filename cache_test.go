@@ -0,0 +1,223 @@
+package gomm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// failingReader fails after reading its content.
+type failingReader struct {
+	rd io.Reader
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+// cacheMatrix stores the matrix in the cache and its manifest, as if
+// downloaded.
+func cacheMatrix(t *testing.T, cache *Cache, matrix *Matrix, content string) {
+	path := cache.Path(matrix)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := writeFile(path, bytes.NewReader(gzipBytes(t, []byte(content))), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.record(matrix, &entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewMatrix("Harwell-Boeing", "bcsstruc1", "bcsstk01")
+	b := NewMatrix("Harwell-Boeing", "smtape", "ash608")
+	if cache.Has(&a) {
+		t.Errorf("Unexpected cache hit for %v", a.Name())
+	}
+	if exp := filepath.Join(dir, "cache", "Harwell-Boeing", "bcsstruc1", "bcsstk01.mtx.gz"); cache.Path(&a) != exp {
+		t.Errorf("Wrong path: exp %v, got %v", exp, cache.Path(&a))
+	}
+
+	cacheMatrix(t, cache, &b, fileMatrix)
+	cacheMatrix(t, cache, &a, fileMatrix)
+	if !cache.Has(&a) || !cache.Has(&b) {
+		t.Errorf("Expected cache hits for %v and %v", a.Name(), b.Name())
+	}
+
+	// cached matrices are not downloaded
+	path, err := cache.Fetch(&a)
+	if err != nil || path != cache.Path(&a) {
+		t.Errorf("Wrong path: exp %v, got %v (%v)", cache.Path(&a), path, err)
+	}
+
+	// temporary files of incomplete downloads are not listed
+	tmp := filepath.Join(filepath.Dir(cache.Path(&a)), ".bcsstk02.mtx.gz.123.tmp")
+	if err := ioutil.WriteFile(tmp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []Matrix{a, b}; !reflect.DeepEqual(list, exp) {
+		t.Errorf("Wrong list: exp %v, got %v", exp, list)
+	}
+
+	if err := cache.Remove(&a); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Has(&a) || !cache.Has(&b) {
+		t.Errorf("Expected only %v to be removed", a.Name())
+	}
+	if err := cache.Remove(&a); err != nil {
+		t.Errorf("Unexpected error removing absent matrix: %v", err)
+	}
+
+	if err := cache.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := cache.List(); err != nil || len(list) != 0 {
+		t.Errorf("Expected empty cache, got %v (%v)", list, err)
+	}
+
+	// keys are restricted to the cache directory
+	for _, m := range []Matrix{NewMatrix("..", "set", "name"), NewMatrix("a", "b/c", "d"), NewMatrix("a", "b", "")} {
+		if _, err := cache.Fetch(&m); err == nil {
+			t.Errorf("Expected error for %v/%v/%v", m.collection, m.set, m.name)
+		}
+	}
+}
+
+func TestCacheVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := &Cache{Dir: dir}
+	a := NewMatrix("Harwell-Boeing", "bcsstruc1", "bcsstk01")
+	b := NewMatrix("Harwell-Boeing", "smtape", "ash608")
+	cacheMatrix(t, cache, &a, fileMatrix)
+	cacheMatrix(t, cache, &b, fileMatrix)
+
+	if err := cache.Verify(&a); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	manifest, err := cache.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest["Harwell-Boeing/bcsstruc1/bcsstk01"]; !ok || len(manifest) != 2 {
+		t.Errorf("Wrong manifest: %v", manifest)
+	}
+
+	// modified files fail verification
+	if err := ioutil.WriteFile(cache.Path(&a), gzipBytes(t, []byte("%%MatrixMarket")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Verify(&a); !errors.Is(err, ErrCorruptDownload) {
+		t.Errorf("Expected error %v, got: %v", ErrCorruptDownload, err)
+	}
+
+	// removed matrices are absent from the manifest
+	if err := cache.Remove(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cache.Path(&b), gzipBytes(t, []byte(fileMatrix)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Verify(&b); !errors.Is(err, ErrCorruptDownload) {
+		t.Errorf("Expected error %v, got: %v", ErrCorruptDownload, err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.mtx.gz")
+	entry, err := writeFile(path, bytes.NewReader([]byte("complete")), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("complete"))
+	if exp := (ManifestEntry{Size: 8, SHA256: hex.EncodeToString(sum[:])}); entry != exp {
+		t.Errorf("Wrong manifest entry: exp %+v, got %+v", exp, entry)
+	}
+
+	// failing and incomplete downloads keep the existing file
+	if _, err := writeFile(path, failingReader{bytes.NewReader([]byte("partial"))}, -1); err == nil {
+		t.Error("Expected error for failing reader")
+	}
+	if _, err := writeFile(path, bytes.NewReader([]byte("partial")), 8); !errors.Is(err, ErrCorruptDownload) {
+		t.Errorf("Expected error %v for wrong size, got: %v", ErrCorruptDownload, err)
+	}
+	truncated := gzipBytes(t, []byte(fileMatrix))
+	truncated = truncated[:len(truncated)-10]
+	if _, err := writeFile(path, bytes.NewReader(truncated), -1); !errors.Is(err, ErrCorruptDownload) {
+		t.Errorf("Expected error %v for truncated gzip, got: %v", ErrCorruptDownload, err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil || string(content) != "complete" {
+		t.Errorf("Wrong content: exp %q, got %q (%v)", "complete", content, err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected temporary files to be removed, got %d files", len(files))
+	}
+}
+
+func TestGetMatrixCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string) { CacheDir = dir }(CacheDir)
+	CacheDir = dir
+
+	cacheMatrix(t, &Cache{Dir: dir}, &Matrix{collection: "c", set: "s", name: "n"}, fileMatrix)
+	got, err := GetMatrix("c", "s", "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := mat.NewDense(2, 2, []float64{1.5, 0, 0, -2}); !mat.Equal(exp, got) {
+		t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(exp), mat.Formatted(got))
+	}
+}
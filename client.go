@@ -0,0 +1,250 @@
+package gomm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Client downloads matrices from the `MatrixMarket`. The zero value downloads
+// by the `DefaultFetcher` into the cache in `CacheDir`, without timeouts or
+// retries. The package level functions, e.g. `GetMatrix`, use the
+// `DefaultClient`.
+type Client struct {
+	// MarketURL is the URL of the list of matrices, see `NewMatrixMarket`.
+	MarketURL string
+
+	// BaseURL is the root URL of the repository of the matrices, e.g.
+	// `https://math.nist.gov/pub/MatrixMarket2`, see `NewFetcher`. When
+	// set, the `Fetcher` is used instead, and when both are empty, the
+	// `DefaultFetcher`.
+	BaseURL string
+	Fetcher Fetcher
+
+	// CacheDir is the directory of the cache, defaults to `CacheDir`.
+	CacheDir string
+
+	// Timeout limits each attempt of a request, including the transfer of
+	// the file. Zero means no timeout.
+	Timeout time.Duration
+
+	// Retries is the number of times a failed request is retried. Before
+	// each retry the client waits `Backoff`, which doubles after each retry
+	// up to `MaxBackoff`, if set. Requests for files that do not exist are
+	// not retried.
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// UserAgent is sent with HTTP requests, when not empty.
+	UserAgent string
+
+	// HTTPClient performs the HTTP requests, defaults to
+	// `http.DefaultClient`.
+	HTTPClient *http.Client
+}
+
+// DefaultClient is the `Client` used by `GetMatrix`, `GetComplexMatrix`,
+// `NewMatrixMarket`, `GetMatrixMarket`, and `Matrix.Download`.
+var DefaultClient = &Client{
+	Timeout:    10 * time.Minute,
+	Retries:    3,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+	UserAgent:  "gomm (https://github.com/maxvdkolk/gomm)",
+}
+
+// fetcher returns the `Fetcher` of the client.
+func (c *Client) fetcher() (Fetcher, error) {
+	if c.Fetcher != nil {
+		return c.Fetcher, nil
+	}
+	if c.BaseURL == "" {
+		return DefaultFetcher, nil
+	}
+
+	f, err := NewFetcher(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := f.(*HTTPFetcher); ok {
+		h.Client, h.UserAgent = c.HTTPClient, c.UserAgent
+	}
+	return f, nil
+}
+
+// temporary reports whether a failed request may succeed when retried. Files
+// that do not exist, permanent FTP replies, and HTTP client errors other than
+// `429 Too Many Requests` are not retried.
+func temporary(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code < 500
+	}
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// retry calls `fn` until it succeeds, or up to `Retries` more times for
+// errors that are temporary. Each attempt is limited by the `Timeout`.
+func (c *Client) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, fn)
+		if err == nil || attempt >= c.Retries || ctx.Err() != nil || !temporary(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; c.MaxBackoff > 0 && backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+// attempt calls `fn` with a context limited by the `Timeout`.
+func (c *Client) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// GetMatrix gets a single matrix from the `MatrixMarket`, see `GetMatrix`.
+// Matrices present in the cache are not downloaded again.
+func (c *Client) GetMatrix(ctx context.Context, collection, set, name string) (mat.Matrix, error) {
+	matrix := NewMatrix(collection, set, name)
+	if err := c.get(ctx, &matrix, false); err != nil {
+		return nil, err
+	}
+	return matrix.mat, nil
+}
+
+// GetComplexMatrix gets a single matrix of `TypeComplex` from the
+// `MatrixMarket`, see `GetComplexMatrix`.
+func (c *Client) GetComplexMatrix(ctx context.Context, collection, set, name string) (mat.CMatrix, error) {
+	matrix := NewMatrix(collection, set, name)
+	if err := c.get(ctx, &matrix, true); err != nil {
+		return nil, err
+	}
+	return matrix.cmat, nil
+}
+
+// get downloads, decompresses, and parses the matrix. Matrices present in the
+// cache are not downloaded again. The compression is detected from the
+// downloaded file, see `ParseFile`.
+func (c *Client) get(ctx context.Context, matrix *Matrix, complex bool) error {
+	dir := c.CacheDir
+	if dir == "" {
+		dir = CacheDir
+	}
+	cache, err := NewCache(dir)
+	if err != nil {
+		return err
+	}
+
+	path, err := cache.fetch(matrix, func(path string) (ManifestEntry, error) {
+		return c.download(ctx, matrix, path)
+	})
+	if err != nil {
+		return err
+	}
+	return matrix.parseFile(path, complex)
+}
+
+// Download downloads the matrix to the file at the given path, which is
+// replaced only once the download completes.
+func (c *Client) Download(ctx context.Context, matrix *Matrix, path string) error {
+	_, err := c.download(ctx, matrix, path)
+	return err
+}
+
+// download downloads the matrix to the file at the given path, retrying
+// failed and incomplete downloads.
+func (c *Client) download(ctx context.Context, matrix *Matrix, path string) (ManifestEntry, error) {
+	fetcher, err := c.fetcher()
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	var entry ManifestEntry
+	err = c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		entry, err = matrix.download(ctx, fetcher, path)
+		return err
+	})
+	return entry, err
+}
+
+// GetMatrixMarket reads the list of matrices, see `GetMatrixMarket`. The list
+// is read completely, such that failures while reading are retried as well.
+func (c *Client) GetMatrixMarket(ctx context.Context) (io.ReadCloser, error) {
+	url := c.MarketURL
+	if url == "" {
+		url = marketUrl
+	}
+
+	var body []byte
+	err := c.retry(ctx, func(ctx context.Context) error {
+		resp, err := get(ctx, c.HTTPClient, url, c.UserAgent)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		body, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+// NewMatrixMarket creates a local representation of the `MatrixMarket`, see
+// `NewMatrixMarket`.
+func (c *Client) NewMatrixMarket(ctx context.Context) (*MatrixMarket, error) {
+	list, err := c.GetMatrixMarket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer list.Close()
+
+	market := new(MatrixMarket)
+
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, `<A HREF="/MatrixMarket/data/`) {
+			m, err := ParseEntry(line)
+			if err != nil {
+				log.Printf("Failed to parse: %#v\n", line)
+			}
+			market.Matrices = append(market.Matrices, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return market, nil
+}
@@ -0,0 +1,222 @@
+package gomm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// testServer serves the responses in order, repeating the last one, and
+// records the requests.
+type testServer struct {
+	mu        sync.Mutex
+	responses []func(w http.ResponseWriter, r *http.Request)
+	requests  []*http.Request
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	k := len(s.requests)
+	if k >= len(s.responses) {
+		k = len(s.responses) - 1
+	}
+	s.requests = append(s.requests, r)
+	s.mu.Unlock()
+	s.responses[k](w, r)
+}
+
+// count returns the number of requests.
+func (s *testServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+// status responds with the status code.
+func status(code int) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// content responds with the content.
+func content(b []byte) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	}
+}
+
+func TestClientGetMatrix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	full := gzipBytes(t, []byte(fileMatrix))
+	exp := mat.NewDense(2, 2, []float64{1.5, 0, 0, -2})
+
+	entries := []struct {
+		responses []func(w http.ResponseWriter, r *http.Request)
+		retries   int
+		requests  int
+		err       bool
+	}{
+		{responses: []func(w http.ResponseWriter, r *http.Request){content(full)}, requests: 1},
+		{
+			responses: []func(w http.ResponseWriter, r *http.Request){
+				status(http.StatusServiceUnavailable),
+				content(full[:len(full)-10]),
+				content(full),
+			},
+			retries:  2,
+			requests: 3,
+		},
+		{
+			responses: []func(w http.ResponseWriter, r *http.Request){status(http.StatusInternalServerError)},
+			retries:   2,
+			requests:  3,
+			err:       true,
+		},
+		{
+			responses: []func(w http.ResponseWriter, r *http.Request){status(http.StatusNotFound)},
+			retries:   2,
+			requests:  1,
+			err:       true,
+		},
+	}
+
+	for k, e := range entries {
+		handler := &testServer{responses: e.responses}
+		server := httptest.NewServer(handler)
+
+		client := &Client{
+			BaseURL:   server.URL + "/mm",
+			CacheDir:  filepath.Join(dir, string(rune('a'+k))),
+			Retries:   e.retries,
+			Backoff:   time.Millisecond,
+			UserAgent: "gomm-test",
+		}
+		got, err := client.GetMatrix(context.Background(), "c", "s", "n")
+		server.Close()
+
+		if (err != nil) != e.err {
+			t.Errorf("Unexpected error for case %d: %v", k, err)
+		}
+		if err == nil && !mat.Equal(exp, got) {
+			t.Errorf("Wrong content for case %d: exp %v, got %v", k, mat.Formatted(exp), mat.Formatted(got))
+		}
+		if handler.count() != e.requests {
+			t.Errorf("Wrong number of requests for case %d: exp %d, got %d", k, e.requests, handler.count())
+		}
+		for _, r := range handler.requests {
+			if r.URL.Path != "/mm/c/s/n.mtx.gz" || r.Header.Get("User-Agent") != "gomm-test" {
+				t.Errorf("Wrong request for case %d: %v %v", k, r.URL, r.Header)
+			}
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	// responds only when the request is canceled
+	handler := &testServer{responses: []func(w http.ResponseWriter, r *http.Request){
+		func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		},
+	}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &Client{
+		BaseURL: server.URL,
+		Timeout: 20 * time.Millisecond,
+		Retries: 1,
+		Backoff: time.Millisecond,
+	}
+	matrix := NewMatrix("c", "s", "n")
+	err = client.Download(context.Background(), &matrix, filepath.Join(dir, "n.mtx.gz"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error %v, got: %v", context.DeadlineExceeded, err)
+	}
+	if handler.count() != 2 {
+		t.Errorf("Wrong number of requests: exp 2, got %d", handler.count())
+	}
+
+	// canceled requests are not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.Retries = 5
+	err = client.Download(ctx, &matrix, filepath.Join(dir, "n.mtx.gz"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error %v, got: %v", context.Canceled, err)
+	}
+	if handler.count() > 2 {
+		t.Errorf("Unexpected requests after canceling: %d", handler.count())
+	}
+}
+
+func TestClientMatrixMarket(t *testing.T) {
+	list := []byte(`<HTML>
+<LI><A HREF="/MatrixMarket/data/Harwell-Boeing/bcsstruc1/bcsstk01.html">BCSSTK01</A>
+<LI><A HREF="/MatrixMarket/data/Harwell-Boeing/smtape/ash608.html">ASH608</A>
+</HTML>
+`)
+	handler := &testServer{responses: []func(w http.ResponseWriter, r *http.Request){
+		status(http.StatusBadGateway),
+		content(list),
+	}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := &Client{MarketURL: server.URL + "/matrices.html", Retries: 1}
+	market, err := client.NewMatrixMarket(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Matrix{
+		NewMatrix("Harwell-Boeing", "bcsstruc1", "bcsstk01"),
+		NewMatrix("Harwell-Boeing", "smtape", "ash608"),
+	}
+	if !reflect.DeepEqual(market.Matrices, exp) {
+		t.Errorf("Wrong matrices: exp %v, got %v", exp, market.Matrices)
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	entries := []struct {
+		err error
+		exp bool
+	}{
+		{err: errors.New("connection reset"), exp: true},
+		{err: ErrCorruptDownload, exp: true},
+		{err: &statusError{code: http.StatusServiceUnavailable}, exp: true},
+		{err: &statusError{code: http.StatusTooManyRequests}, exp: true},
+		{err: &statusError{code: http.StatusNotFound}, exp: false},
+		{err: &textproto.Error{Code: 421}, exp: true},
+		{err: &textproto.Error{Code: 550}, exp: false},
+		{err: os.ErrNotExist, exp: false},
+	}
+
+	for _, e := range entries {
+		if got := temporary(e.err); got != e.exp {
+			t.Errorf("Wrong result for %v: exp %v, got %v", e.err, e.exp, got)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package gomm
+
+import (
+	"bufio"
+	"fmt"
+	"math/cmplx"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ComplexCSR is a compressed sparse row matrix with complex values. It holds
+// the non-zeroes of `TypeComplex` matrices in `FormatCoordinate` and satisfies
+// the `mat.CMatrix` interface.
+type ComplexCSR struct {
+	n, m   int
+	indptr []int
+	ind    []int
+	data   []complex128
+}
+
+// NewComplexCSR forms a `ComplexCSR` of dimensions `(n, m)` from COO-triplets.
+// The triplets do not need to be sorted and duplicate entries are summed.
+func NewComplexCSR(n, m int, I, J []int, V []complex128) *ComplexCSR {
+	// sort a permutation of the triplets by row, then column
+	perm := make([]int, len(V))
+	for k := range perm {
+		perm[k] = k
+	}
+	sort.SliceStable(perm, func(a, b int) bool {
+		if I[perm[a]] != I[perm[b]] {
+			return I[perm[a]] < I[perm[b]]
+		}
+		return J[perm[a]] < J[perm[b]]
+	})
+
+	csr := &ComplexCSR{
+		n:      n,
+		m:      m,
+		indptr: make([]int, n+1),
+		ind:    make([]int, 0, len(V)),
+		data:   make([]complex128, 0, len(V)),
+	}
+
+	for k, p := range perm {
+		// sum duplicates into the previously inserted entry
+		if k > 0 && I[p] == I[perm[k-1]] && J[p] == J[perm[k-1]] {
+			csr.data[len(csr.data)-1] += V[p]
+			continue
+		}
+		csr.ind = append(csr.ind, J[p])
+		csr.data = append(csr.data, V[p])
+		csr.indptr[I[p]+1]++
+	}
+
+	// cumulative sum of the number of entries per row
+	for i := 0; i < n; i++ {
+		csr.indptr[i+1] += csr.indptr[i]
+	}
+	return csr
+}
+
+// Dims returns the dimensions of the matrix `(rows, cols)`.
+func (csr *ComplexCSR) Dims() (int, int) {
+	return csr.n, csr.m
+}
+
+// At returns the value of the matrix at `(i,j)`.
+func (csr *ComplexCSR) At(i, j int) complex128 {
+	if i < 0 || i >= csr.n || j < 0 || j >= csr.m {
+		panic(mat.ErrIndexOutOfRange)
+	}
+
+	// column indices are sorted within a row
+	lo, hi := csr.indptr[i], csr.indptr[i+1]
+	k := lo + sort.SearchInts(csr.ind[lo:hi], j)
+	if k < hi && csr.ind[k] == j {
+		return csr.data[k]
+	}
+	return 0
+}
+
+// H returns the conjugate transpose of the matrix.
+func (csr *ComplexCSR) H() mat.CMatrix {
+	return csr.transpose(true)
+}
+
+// T returns the transpose of the matrix, without conjugation.
+func (csr *ComplexCSR) T() mat.CMatrix {
+	return csr.transpose(false)
+}
+
+// transpose forms a new matrix holding the, optionally conjugated, transpose.
+func (csr *ComplexCSR) transpose(conj bool) *ComplexCSR {
+	I := make([]int, 0, csr.NNZ())
+	J := make([]int, 0, csr.NNZ())
+	V := make([]complex128, 0, csr.NNZ())
+	csr.DoNonZero(func(i, j int, v complex128) {
+		if conj {
+			v = cmplx.Conj(v)
+		}
+		I = append(I, j)
+		J = append(J, i)
+		V = append(V, v)
+	})
+	return NewComplexCSR(csr.m, csr.n, I, J, V)
+}
+
+// NNZ returns the number of stored entries.
+func (csr *ComplexCSR) NNZ() int {
+	return len(csr.data)
+}
+
+// DoNonZero calls the function `fn` for each of the stored entries, in row
+// major order.
+func (csr *ComplexCSR) DoNonZero(fn func(i, j int, v complex128)) {
+	for i := 0; i < csr.n; i++ {
+		for k := csr.indptr[i]; k < csr.indptr[i+1]; k++ {
+			fn(i, csr.ind[k], csr.data[k])
+		}
+	}
+}
+
+// splitComplex parses a complex value from its real and imaginary strings.
+func splitComplex(re, im string) (complex128, error) {
+	r, err := parseFloat([]byte(re))
+	if err != nil {
+		return 0, err
+	}
+
+	c, err := parseFloat([]byte(im))
+	if err != nil {
+		return 0, err
+	}
+	return complex(r, c), nil
+}
+
+// splitComplexTriplet splits a complex COO-triplet of (i, j, re, im) form from
+// strings to two integer indices (i, j) and the matching complex value.
+func splitComplexTriplet(s string) (i int, j int, v complex128, err error) {
+	splits := strings.Fields(strings.TrimSpace(s))
+	if len(splits) != 4 {
+		return i, j, v, fmt.Errorf("%w: wrong number of values to unpack complex triplet %d, exp 4", ErrInvalidEntry, len(splits))
+	}
+
+	i, err = strconv.Atoi(splits[0])
+	if err != nil {
+		return i, j, v, err
+	}
+
+	j, err = strconv.Atoi(splits[1])
+	if err != nil {
+		return i, j, v, err
+	}
+
+	v, err = splitComplex(splits[2], splits[3])
+	if err != nil {
+		return i, j, v, err
+	}
+
+	return i, j, v, nil
+}
+
+// parseComplexCoordinate parses a `MatrixMarket` of the `Coordinate` format
+// with complex values into a `ComplexCSR`.
+func (matrix *Matrix) parseComplexCoordinate(buf *bufio.Reader) error {
+	n, m := matrix.Dims()
+	if n == 0 || m == 0 {
+		err := fmt.Errorf("%w: matrix dimensions are empty (%d, %d)", ErrInvalidSize, n, m)
+		return matrix.parseError(SectionSize, "", err)
+	}
+
+	nnz := preallocSize(matrix.lines)
+	I, J, V := make([]int, 0, nnz), make([]int, 0, nnz), make([]complex128, 0, nnz)
+	lines := make([]int, 0, nnz)
+
+	// exhaust all lines with scanner
+	scanner := matrix.newScanner(buf)
+	entries := 0
+	for scanner.Scan() {
+		matrix.line++
+		line := scanner.Text()
+		if isBlank(scanner.Bytes()) {
+			continue
+		}
+		i, j, v, err := splitComplexTriplet(line)
+		if err != nil {
+			return matrix.parseError(SectionData, line, err)
+		}
+
+		entries++
+		if ok, err := matrix.checkEntry(entries, i, j); !ok {
+			if err != nil {
+				return matrix.parseError(SectionData, line, err)
+			}
+			continue
+		}
+		if err := matrix.checkFinite(v); err != nil {
+			return matrix.parseError(SectionData, line, err)
+		}
+
+		if v == 0 {
+			matrix.zeros++
+		}
+
+		// correct for one-base
+		I, J, V = append(I, i-1), append(J, j-1), append(V, v)
+		lines = append(lines, matrix.line)
+	}
+	if err := scanner.Err(); err != nil {
+		return matrix.scanError(SectionData, err)
+	}
+	if err := matrix.checkEntries(entries); err != nil {
+		return err
+	}
+	return matrix.assembleComplex(I, J, V, lines)
+}
+
+// assembleComplex forms the `ComplexCSR` from the parsed triplets, after
+// combining duplicates and expanding the symmetry.
+func (matrix *Matrix) assembleComplex(I, J []int, V []complex128, lines []int) error {
+	n, m := matrix.Dims()
+	nnz := len(V)
+
+	// entries of the upper triangle are stored as their lower counterpart,
+	// such that these are combined with duplicates of the lower triangle
+	if matrix.Symmetry != General {
+		for k := range V {
+			if I[k] >= J[k] {
+				continue
+			}
+			I[k], J[k] = J[k], I[k]
+			switch matrix.Symmetry {
+			case SkewSymmetric:
+				V[k] = -V[k]
+			case Hermitian:
+				V[k] = cmplx.Conj(V[k])
+			}
+		}
+	}
+
+	// combine duplicates before forming the matrix
+	cI, cJ, cV := make([]int, 0, nnz), make([]int, 0, nnz), make([]complex128, 0, nnz)
+	err := matrix.groupEntries(I, J, lines, func(group []int) {
+		var v complex128
+		for _, k := range matrix.selectEntries(group) {
+			v += V[k]
+		}
+
+		// explicit zeros are only inserted on request
+		if v == 0 && matrix.Options.Zeros == DropZeros {
+			return
+		}
+
+		i, j := I[group[0]], J[group[0]]
+		cI, cJ, cV = append(cI, i), append(cJ, j), append(cV, v)
+
+		// for symmetric types also insert its symmetric counterpart
+		if i != j {
+			switch matrix.Symmetry {
+			case Symmetric:
+				cI, cJ, cV = append(cI, j), append(cJ, i), append(cV, v)
+			case SkewSymmetric:
+				cI, cJ, cV = append(cI, j), append(cJ, i), append(cV, -v)
+			case Hermitian:
+				cI, cJ, cV = append(cI, j), append(cJ, i), append(cV, cmplx.Conj(v))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	csr := NewComplexCSR(n, m, cI, cJ, cV)
+	matrix.cmat = csr
+	matrix.nnz = csr.NNZ()
+	return nil
+}
+
+// parseComplexArray parses a `MatrixMarket` of format `Array` with complex
+// values, each line holding the real and imaginary part, into a `*mat.CDense`.
+func (matrix *Matrix) parseComplexArray(buf *bufio.Reader) error {
+	n, m := matrix.Dims()
+	if n == 0 || m == 0 {
+		err := fmt.Errorf("%w: matrix dimensions are empty (%d, %d)", ErrInvalidSize, n, m)
+		return matrix.parseError(SectionSize, "", err)
+	}
+
+	size := arrayLength(n, m, matrix.Symmetry)
+	values := make([]complex128, 0, preallocSize(size))
+
+	// exhaust all lines with scanner
+	scanner := matrix.newScanner(buf)
+	for scanner.Scan() {
+		matrix.line++
+		line := scanner.Text()
+		if isBlank(scanner.Bytes()) {
+			continue
+		}
+		splits := strings.Fields(line)
+		if len(splits) != 2 {
+			err := fmt.Errorf("%w: expected real and imaginary part, got %d values", ErrInvalidEntry, len(splits))
+			return matrix.parseError(SectionData, line, err)
+		}
+
+		v, err := splitComplex(splits[0], splits[1])
+		if err != nil {
+			return matrix.parseError(SectionData, line, err)
+		}
+		if len(values) == size {
+			err := fmt.Errorf("%w: exp %d for matrix of dimensions (%d, %d)", ErrTooManyEntries, size, n, m)
+			return matrix.parseError(SectionData, line, err)
+		}
+		if err := matrix.checkFinite(v); err != nil {
+			return matrix.parseError(SectionData, line, err)
+		}
+		values = append(values, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return matrix.scanError(SectionData, err)
+	}
+	if len(values) != size {
+		err := fmt.Errorf("%w: got %d entries, exp %d", ErrUnexpectedEOF, len(values), size)
+		return matrix.parseError(SectionData, "", err)
+	}
+
+	// `MatrixMarket` is column-major, `mat.CDense` is row-major; for
+	// symmetric types the upper-triangular part is filled from the lower
+	cd := mat.NewCDense(n, m, nil)
+	doArrayEntry(n, m, matrix.Symmetry, func(k, r, c int) {
+		v := values[k]
+		cd.Set(r, c, v)
+		if r == c {
+			return
+		}
+		switch matrix.Symmetry {
+		case Symmetric:
+			cd.Set(c, r, v)
+		case SkewSymmetric:
+			cd.Set(c, r, -v)
+		case Hermitian:
+			cd.Set(c, r, cmplx.Conj(v))
+		}
+	})
+	matrix.cmat = cd
+	return nil
+}
@@ -0,0 +1,69 @@
+package gomm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sections of a `MatrixMarket` file, used to locate a `ParseError`.
+const (
+	SectionHeader  = "header"
+	SectionComment = "comment"
+	SectionSize    = "size"
+	SectionData    = "data"
+)
+
+// Sentinel errors wrapped by `ParseError`, these can be detected using
+// `errors.Is`.
+var (
+	ErrInvalidHeader       = errors.New("Invalid header")
+	ErrUnsupportedObject   = errors.New("Unsupported object")
+	ErrUnsupportedFormat   = errors.New("Unsupported format")
+	ErrUnsupportedType     = errors.New("Unsupported type")
+	ErrUnsupportedSymmetry = errors.New("Unsupported symmetry")
+	ErrInvalidSize         = errors.New("Invalid size")
+	ErrInvalidEntry        = errors.New("Invalid entry")
+	ErrIndexOutOfRange     = errors.New("Index out of range")
+	ErrTooManyEntries      = errors.New("Too many entries")
+	ErrDuplicateEntry      = errors.New("Duplicate entry")
+	ErrUnexpectedEOF       = errors.New("Unexpected end of file")
+	ErrLineTooLong         = errors.New("Line too long")
+	ErrNonFinite           = errors.New("Non-finite value")
+	ErrCorruptDownload     = errors.New("Corrupt download")
+)
+
+// ParseError describes a failure to parse a `MatrixMarket` file. It records
+// the line number, the section of the file, and the raw text of the offending
+// line. The underlying cause is wrapped, e.g. one of the sentinel errors or a
+// `*strconv.NumError`, such that it can be inspected with `errors.Is` and
+// `errors.As`.
+type ParseError struct {
+	Line    int
+	Section string
+	Text    string
+	Err     error
+}
+
+// Error formats the error with its location.
+func (e *ParseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("line %d (%s): %v", e.Line, e.Section, e.Err)
+	}
+	return fmt.Sprintf("line %d (%s): %v: %q", e.Line, e.Section, e.Err, e.Text)
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError forms a `ParseError` at the current line of the matrix.
+func (matrix *Matrix) parseError(section, text string, err error) error {
+	return &ParseError{
+		Line:    matrix.line,
+		Section: section,
+		Text:    strings.TrimRight(text, "\r\n"),
+		Err:     err,
+	}
+}
@@ -0,0 +1,227 @@
+package gomm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// Fetcher retrieves the files of the `MatrixMarket` by their path relative to
+// the root of the repository, e.g. `Harwell-Boeing/bcsstruc1/bcsstk01.mtx.gz`.
+// The size of the file is returned when known, or -1 otherwise.
+type Fetcher interface {
+	Fetch(ctx context.Context, path string) (io.ReadCloser, int64, error)
+}
+
+// DefaultFetcher is the `Fetcher` used by `Download` and by caches without
+// a `Fetcher` of their own.
+var DefaultFetcher Fetcher = &FTPFetcher{}
+
+// NewFetcher returns the `Fetcher` for the root URL of a repository, selected
+// by its scheme: `ftp://host[:port]/root`, `http(s)://host/root`, or
+// `file:///root` for a local mirror.
+func NewFetcher(root string) (Fetcher, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "ftp":
+		addr := u.Host
+		if u.Port() == "" {
+			addr += ":21"
+		}
+		return &FTPFetcher{Addr: addr, Root: strings.TrimPrefix(u.Path, "/")}, nil
+	case "http", "https":
+		return &HTTPFetcher{BaseURL: strings.TrimSuffix(root, "/")}, nil
+	case "file":
+		return &FileFetcher{Root: filepath.FromSlash(u.Path)}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported scheme for fetching: %#v", u.Scheme)
+	}
+}
+
+// remotePath returns the path of the matrix relative to the root of the
+// repository. The repository provides all matrices in the `MatrixMarket`
+// format, which is retrieved also for those of the Harwell-Boeing collection.
+func (matrix *Matrix) remotePath() string {
+	return fmt.Sprintf("%s/%s/%s.mtx.gz", matrix.collection, matrix.set, matrix.name)
+}
+
+// FTPFetcher retrieves files over FTP with an anonymous login. The address
+// defaults to the NIST server `math.nist.gov:21`, and the root to
+// `pub/MatrixMarket2`.
+type FTPFetcher struct {
+	Addr string
+	Root string
+}
+
+// ftpFile is a file retrieved over FTP, closing it ends the connection.
+type ftpFile struct {
+	*ftp.Response
+	stop chan struct{}
+	quit func()
+}
+
+// Close closes the file and the connection.
+func (f ftpFile) Close() error {
+	close(f.stop)
+	err := f.Response.Close()
+	f.quit()
+	return err
+}
+
+// Fetch retrieves the file at the path relative to the root.
+func (f *FTPFetcher) Fetch(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	addr, root := f.Addr, f.Root
+	if addr == "" {
+		addr = ftpDialUrl + `:21`
+	}
+	if root == "" {
+		root = ftpRoot
+	}
+
+	c, err := ftp.Dial(addr, ftp.DialWithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the connection only respects the context while dialing, afterwards
+	// it is ended when the context is done, which interrupts any transfer
+	var once sync.Once
+	quit := func() { once.Do(func() { c.Quit() }) }
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			quit()
+		case <-stop:
+		}
+	}()
+	fail := func(err error) (io.ReadCloser, int64, error) {
+		close(stop)
+		quit()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, 0, err
+	}
+
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		return fail(err)
+	}
+
+	// not all servers report sizes
+	remote := root + "/" + path
+	size, err := c.FileSize(remote)
+	if err != nil || size <= 0 {
+		size = -1
+	}
+
+	r, err := c.Retr(remote)
+	if err != nil {
+		return fail(err)
+	}
+	return ftpFile{Response: r, stop: stop, quit: quit}, size, nil
+}
+
+// HTTPFetcher retrieves files over HTTP(S). The base URL defaults to
+// `https://math.nist.gov/pub/MatrixMarket2`, and the client to
+// `http.DefaultClient`, which uses the proxy of the environment. The user agent
+// is set on each request, when not empty.
+type HTTPFetcher struct {
+	BaseURL   string
+	Client    *http.Client
+	UserAgent string
+}
+
+// statusError reports a response of an HTTP server other than `200 OK`.
+type statusError struct {
+	url    string
+	status string
+	code   int
+}
+
+// Error formats the error with the requested URL.
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Failed to fetch %v: %v", e.url, e.status)
+}
+
+// get performs a GET request with the user agent, and returns the body of a
+// `200 OK` response.
+func get(ctx context.Context, client *http.Client, url, userAgent string) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	// the content is returned as served, such that compressed files are not
+	// decompressed in transfer
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// Fetch retrieves the file at the path relative to the base URL.
+func (f *HTTPFetcher) Fetch(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	base := f.BaseURL
+	if base == "" {
+		base = httpsUrl
+	}
+
+	resp, err := get(ctx, f.Client, base+"/"+path, f.UserAgent)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// FileFetcher retrieves files from a local mirror of the repository, e.g. on
+// a shared file system.
+type FileFetcher struct {
+	Root string
+}
+
+// Fetch opens the file at the path relative to the root.
+func (f *FileFetcher) Fetch(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	file, err := os.Open(filepath.Join(f.Root, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
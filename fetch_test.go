@@ -0,0 +1,156 @@
+package gomm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// mirror writes the matrices, by their remote path, to a local mirror.
+func mirror(t *testing.T, dir string, files map[string][]byte) {
+	for name, b := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewFetcher(t *testing.T) {
+	entries := []struct {
+		root string
+		exp  Fetcher
+	}{
+		{root: "ftp://math.nist.gov/pub/MatrixMarket2", exp: &FTPFetcher{Addr: "math.nist.gov:21", Root: "pub/MatrixMarket2"}},
+		{root: "ftp://localhost:2121/mm", exp: &FTPFetcher{Addr: "localhost:2121", Root: "mm"}},
+		{root: "https://mirror.example.com/mm/", exp: &HTTPFetcher{BaseURL: "https://mirror.example.com/mm"}},
+		{root: "file:///srv/mm", exp: &FileFetcher{Root: filepath.FromSlash("/srv/mm")}},
+	}
+
+	for _, e := range entries {
+		f, err := NewFetcher(e.root)
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", e.root, err)
+		}
+		if !reflect.DeepEqual(f, e.exp) {
+			t.Errorf("Wrong fetcher for %v: exp %+v, got %+v", e.root, e.exp, f)
+		}
+	}
+
+	if _, err := NewFetcher("gopher://example.com"); err == nil {
+		t.Error("Expected error for unsupported scheme")
+	}
+}
+
+func TestFetchers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := gzipBytes(t, []byte(fileMatrix))
+	mirror(t, filepath.Join(dir, "mirror"), map[string][]byte{"c/s/n.mtx.gz": content})
+
+	var requests []*http.Request
+	files := http.StripPrefix("/mm", http.FileServer(http.Dir(filepath.Join(dir, "mirror"))))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	fetchers := []Fetcher{
+		&FileFetcher{Root: filepath.Join(dir, "mirror")},
+		&HTTPFetcher{BaseURL: server.URL + "/mm"},
+	}
+
+	for k, fetcher := range fetchers {
+		cache := &Cache{Dir: filepath.Join(dir, "cache"), Fetcher: fetcher}
+		matrix := NewMatrix("c", "s", "n")
+		path, err := cache.Fetch(&matrix)
+		if err != nil {
+			t.Fatalf("Unexpected error for %T: %v", fetcher, err)
+		}
+		if err := cache.Verify(&matrix); err != nil {
+			t.Errorf("Unexpected error for %T: %v", fetcher, err)
+		}
+		got, err := (&Matrix{}).ParseFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := mat.NewDense(2, 2, []float64{1.5, 0, 0, -2}); !mat.Equal(exp, got) {
+			t.Errorf("Wrong content for %T: exp %v, got %v", fetcher, mat.Formatted(exp), mat.Formatted(got))
+		}
+
+		// missing matrices are reported
+		missing := NewMatrix("c", "s", "missing")
+		if _, err := cache.Fetch(&missing); err == nil {
+			t.Errorf("Expected error for missing matrix by %T", fetcher)
+		}
+
+		if err := cache.Purge(); err != nil {
+			t.Fatal(err)
+		}
+		if k == 1 && (len(requests) == 0 || requests[0].Header.Get("Accept-Encoding") != "identity") {
+			t.Errorf("Expected uncompressed transfer, got requests %v", requests)
+		}
+	}
+}
+
+func TestCacheRefetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "mirror")
+	cache := &Cache{Dir: filepath.Join(dir, "cache"), Fetcher: &FileFetcher{Root: root}}
+	matrix := NewMatrix("c", "s", "n")
+
+	// corrupt cached files are downloaded again
+	mirror(t, root, map[string][]byte{"c/s/n.mtx.gz": gzipBytes(t, []byte(fileMatrix))})
+	path, err := cache.Fetch(&matrix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Fetch(&matrix); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Verify(&matrix); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// corrupt downloads are reported, and keep the cache unchanged
+	other := NewMatrix("c", "s", "truncated")
+	truncated := gzipBytes(t, []byte(fileMatrix))
+	mirror(t, root, map[string][]byte{"c/s/truncated.mtx.gz": truncated[:len(truncated)-10]})
+	if _, err := cache.Fetch(&other); !errors.Is(err, ErrCorruptDownload) {
+		t.Errorf("Expected error %v, got: %v", ErrCorruptDownload, err)
+	}
+	if cache.Has(&other) {
+		t.Error("Unexpected cached corrupt download")
+	}
+
+	// fetching respects the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := cache.Fetcher.Fetch(ctx, matrix.remotePath()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error %v, got: %v", context.Canceled, err)
+	}
+}
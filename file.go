@@ -0,0 +1,310 @@
+package gomm
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Magic bytes that identify the compression of a file, and the archive format.
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicTar   = []byte("ustar")
+)
+
+// tarMagicOffset is the offset of the magic bytes in the header of a tar
+// archive.
+const tarMagicOffset = 257
+
+// readCloser reads from the reader and closes the underlying file.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompress returns a reader of the decompressed content, detecting the
+// compression from its magic bytes: `gzip`, `bzip2`, `xz` and `zstd` are
+// supported. Uncompressed content is returned as is. It reports whether the
+// content is a tar archive.
+func decompress(rd io.Reader) (io.Reader, bool, error) {
+	buf := bufio.NewReader(rd)
+	magic, _ := buf.Peek(len(magicXz))
+
+	var r io.Reader = buf
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		zr, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, false, err
+		}
+		r = zr
+	case bytes.HasPrefix(magic, magicBzip2):
+		r = bzip2.NewReader(buf)
+	case bytes.HasPrefix(magic, magicXz):
+		xr, err := xz.NewReader(buf)
+		if err != nil {
+			return nil, false, err
+		}
+		r = xr
+	case bytes.HasPrefix(magic, magicZstd):
+		// a single goroutine decodes synchronously, the decoder is not closed
+		zr, err := zstd.NewReader(buf, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, err
+		}
+		r = zr
+	}
+
+	// tar archives, possibly compressed
+	buf = bufio.NewReader(r)
+	magic, _ = buf.Peek(tarMagicOffset + len(magicTar))
+	return buf, bytes.HasSuffix(magic, magicTar) && len(magic) == tarMagicOffset+len(magicTar), nil
+}
+
+// isMatrixEntry reports whether the entry of a tar archive is a file in the
+// `MatrixMarket` format.
+func isMatrixEntry(hdr *tar.Header) bool {
+	regular := hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA
+	return regular && strings.HasSuffix(hdr.Name, ".mtx")
+}
+
+// mainEntry returns the main matrix among the `MatrixMarket` files of a tar
+// archive: the file named after its directory, as in the SuiteSparse bundles
+// holding `name/name.mtx`, or otherwise the first file.
+func mainEntry(names []string) string {
+	for _, name := range names {
+		if isMainEntry(name) {
+			return name
+		}
+	}
+	if len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// isMainEntry reports whether the file of a tar archive is named after its
+// directory, i.e. `name/name.mtx`.
+func isMainEntry(name string) bool {
+	dir, file := path.Split(name)
+	return dir != "" && strings.TrimSuffix(file, ".mtx") == path.Base(dir)
+}
+
+// companionKey returns the key of a companion file of the main matrix, i.e.
+// its name without the name of the main matrix, e.g. `b` for `name_b.mtx`.
+func companionKey(main, name string) string {
+	prefix := strings.TrimSuffix(path.Base(main), ".mtx") + "_"
+	return strings.TrimPrefix(strings.TrimSuffix(path.Base(name), ".mtx"), prefix)
+}
+
+// openArchive returns a reader of the main matrix of the tar archive, see
+// `mainEntry`. The archive is read once: the first `MatrixMarket` file is
+// held in memory until a file named after its directory is found.
+func openArchive(name string, rd io.Reader) (io.Reader, error) {
+	var first []byte
+	found := false
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isMatrixEntry(hdr) {
+			continue
+		}
+		if isMainEntry(hdr.Name) {
+			return tr, nil
+		}
+		if !found {
+			if first, err = ioutil.ReadAll(tr); err != nil {
+				return nil, err
+			}
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("No matrix found in archive %v", name)
+	}
+	return bytes.NewReader(first), nil
+}
+
+// Open opens the file at the given path and returns a reader of its
+// decompressed content. The compression is detected from the magic bytes of
+// the file, see `decompress`, such that plain `.mtx`, `.mtx.gz`, and
+// `.mtx.bz2` files are read alike. For tar archives, e.g. the `.tar.gz`
+// bundles of the SuiteSparse collection, the content of the main matrix is
+// returned: the `.mtx` file named after its directory, or otherwise the first
+// `.mtx` file of the archive.
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rd, isTar, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !isTar {
+		return readCloser{rd, f}, nil
+	}
+
+	if rd, err = openArchive(f.Name(), rd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{rd, f}, nil
+}
+
+// Matrix returns the parsed matrix, or nil for matrices of `TypeComplex`.
+func (matrix *Matrix) Matrix() mat.Matrix {
+	return matrix.mat
+}
+
+// Companions returns the companion files of a matrix parsed from a tar
+// archive by `ParseFile`, e.g. the right-hand side `name_b.mtx` of the matrix
+// `name.mtx`, keyed by their name without the name of the main matrix, i.e.
+// `b`. The matrices are parsed with any value type, such that either
+// `Matrix` or `CMatrix` holds their values.
+func (matrix *Matrix) Companions() map[string]*Matrix {
+	return matrix.companions
+}
+
+// ParseFile parses the matrix of the file at the given path, which is
+// decompressed as by `Open`. Files in the Harwell-Boeing format, i.e. files
+// that do not start with the `%%MatrixMarket` banner, are parsed as by
+// `ParseHarwellBoeing`. For tar archives, the main matrix is parsed, and all
+// other `.mtx` files of the archive are available from `Companions`.
+// Matrices of `TypeComplex` should be parsed with `ParseFileComplex` instead.
+func (matrix *Matrix) ParseFile(path string) (mat.Matrix, error) {
+	if err := matrix.parseFile(path, false); err != nil {
+		return nil, err
+	}
+	return matrix.mat, nil
+}
+
+// ParseFileComplex parses the matrix of `TypeComplex` of the file at the given
+// path, similar to `ParseFile`.
+func (matrix *Matrix) ParseFileComplex(path string) (mat.CMatrix, error) {
+	if err := matrix.parseFile(path, true); err != nil {
+		return nil, err
+	}
+	return matrix.cmat, nil
+}
+
+// parseFile decompresses and parses the file, and the companion files of tar
+// archives.
+func (matrix *Matrix) parseFile(path string, complex bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rd, isTar, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	if !isTar {
+		return matrix.parseContent(rd, complex)
+	}
+
+	// parse all matrices of the archive, before selecting the main matrix
+	var names []string
+	matrices := make(map[string]*Matrix)
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !isMatrixEntry(hdr) {
+			continue
+		}
+
+		entry := &Matrix{Options: matrix.Options}
+		if err := entry.parseAny(tr); err != nil {
+			return fmt.Errorf("Archive entry %v: %w", hdr.Name, err)
+		}
+		names = append(names, hdr.Name)
+		matrices[hdr.Name] = entry
+	}
+
+	main := mainEntry(names)
+	if main == "" {
+		return fmt.Errorf("No matrix found in archive %v", f.Name())
+	}
+	if err := matrices[main].checkComplex(complex); err != nil {
+		err = &ParseError{Line: 1, Section: SectionHeader, Err: err}
+		return fmt.Errorf("Archive entry %v: %w", main, err)
+	}
+
+	companions := make(map[string]*Matrix)
+	for _, name := range names {
+		if name != main {
+			companions[companionKey(main, name)] = matrices[name]
+		}
+	}
+
+	// the main matrix keeps the names of the collection
+	parsed := matrices[main]
+	parsed.collection, parsed.set, parsed.name = matrix.collection, matrix.set, matrix.name
+	parsed.companions = companions
+	*matrix = *parsed
+	return nil
+}
+
+// parseContent parses a matrix in the `MatrixMarket` format or, for content
+// that does not start with a comment or the `%%MatrixMarket` banner, in the
+// Harwell-Boeing format.
+func (matrix *Matrix) parseContent(rd io.Reader, complex bool) error {
+	buf := bufio.NewReader(rd)
+	if isHarwellBoeing(buf) {
+		return matrix.parseHarwellBoeing(buf, complex)
+	}
+	return matrix.parse(buf, complex)
+}
+
+// isHarwellBoeing reports whether the first line of the content does not
+// start with `%`, as `MatrixMarket` files do. Empty content is considered to
+// be `MatrixMarket`, such that it is reported as such.
+func isHarwellBoeing(buf *bufio.Reader) bool {
+	b, _ := buf.Peek(256)
+	if k := bytes.IndexByte(b, '\n'); k >= 0 {
+		b = b[:k]
+	}
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] != '%'
+}
+
+// parseAny parses a matrix of any value type.
+func (matrix *Matrix) parseAny(rd io.Reader) error {
+	buf := bufio.NewReader(rd)
+	if err := matrix.ParseHeader(buf); err != nil {
+		return err
+	}
+	return matrix.parseBody(buf)
+}
@@ -0,0 +1,255 @@
+package gomm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"gonum.org/v1/gonum/mat"
+)
+
+const fileMatrix = `%%MatrixMarket matrix coordinate real general
+2 2 2
+1 1 1.5
+2 2 -2
+`
+
+// fileMatrixBzip2 holds `fileMatrix` compressed by bzip2, as the standard
+// library only provides its decompression.
+var fileMatrixBzip2 = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x82, 0x5e,
+	0x79, 0xfb, 0x00, 0x00, 0x07, 0x5d, 0x80, 0x00, 0x10, 0x42, 0x03, 0x32,
+	0x00, 0x00, 0x02, 0x2e, 0xaf, 0x94, 0x40, 0x20, 0x00, 0x48, 0x80, 0xa7,
+	0x93, 0x29, 0xa6, 0x86, 0x27, 0x94, 0x22, 0x68, 0xd3, 0x43, 0x46, 0x80,
+	0x34, 0x60, 0xb7, 0xa6, 0xe0, 0x43, 0x49, 0x5e, 0x5a, 0x21, 0xd0, 0xc3,
+	0x92, 0x13, 0x0b, 0xc3, 0x53, 0xe2, 0x64, 0xe1, 0x7a, 0x2d, 0xb4, 0xaf,
+	0xca, 0x3b, 0x04, 0x9b, 0xf9, 0x9e, 0x25, 0x50, 0x32, 0x17, 0x18, 0x7c,
+	0x5d, 0xc9, 0x14, 0xe1, 0x42, 0x42, 0x09, 0x79, 0xe7, 0xec,
+}
+
+// gzipBytes compresses the bytes by gzip.
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// xzBytes compresses the bytes by xz.
+func xzBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	xw, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zstdBytes compresses the bytes by zstd.
+func zstdBytes(t *testing.T, b []byte) []byte {
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll(b, nil)
+}
+
+// tarBytes forms a tar archive of the files, in the given order.
+func tarBytes(t *testing.T, names []string, files map[string]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTemp writes the bytes to a file in the directory.
+func writeTemp(t *testing.T, dir, name string, b []byte) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exp := mat.NewDense(2, 2, []float64{1.5, 0, 0, -2})
+	bundle := map[string]string{
+		"test/test.mtx":   fileMatrix,
+		"test/test_b.mtx": "%%MatrixMarket matrix array real general\n2 1\n1\n2\n",
+		"test/test_z.mtx": "%%MatrixMarket matrix array complex general\n1 1\n1 -1\n",
+		"test/README.txt": "not a matrix",
+	}
+	names := []string{"test/README.txt", "test/test_b.mtx", "test/test.mtx", "test/test_z.mtx"}
+
+	files := map[string][]byte{
+		"test.mtx":     []byte(fileMatrix),
+		"test.mtx.gz":  gzipBytes(t, []byte(fileMatrix)),
+		"test.mtx.bz2": fileMatrixBzip2,
+		"test.mtx.xz":  xzBytes(t, []byte(fileMatrix)),
+		"test.mtx.zst": zstdBytes(t, []byte(fileMatrix)),
+		"test.tar.zst": zstdBytes(t, tarBytes(t, names, bundle)),
+		"test.tar":     tarBytes(t, names, bundle),
+		"test.tar.gz":  gzipBytes(t, tarBytes(t, names, bundle)),
+		"single.tar":   tarBytes(t, []string{"matrix.mtx"}, map[string]string{"matrix.mtx": fileMatrix}),
+		"misnamed.txt": gzipBytes(t, []byte(fileMatrix)),
+	}
+
+	for name, b := range files {
+		file := writeTemp(t, dir, name, b)
+
+		matrix := &Matrix{}
+		got, err := matrix.ParseFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", name, err)
+		}
+		if !mat.Equal(exp, got) {
+			t.Errorf("Wrong content for %v: exp %v, got %v", name, mat.Formatted(exp), mat.Formatted(got))
+		}
+
+		rd, err := Open(file)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", name, err)
+		}
+		content, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rd.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != fileMatrix {
+			t.Errorf("Wrong content for %v: exp %q, got %q", name, fileMatrix, content)
+		}
+	}
+
+	// companion files of the archive
+	matrix := &Matrix{}
+	if _, err := matrix.ParseFile(filepath.Join(dir, "test.tar.gz")); err != nil {
+		t.Fatal(err)
+	}
+	companions := matrix.Companions()
+	if len(companions) != 2 {
+		t.Fatalf("Wrong number of companions: exp 2, got %d", len(companions))
+	}
+	if b := companions["b"]; b == nil || !mat.Equal(b.Matrix(), mat.NewDense(2, 1, []float64{1, 2})) {
+		t.Errorf("Wrong companion %q: %v", "b", b)
+	}
+	if z := companions["z"]; z == nil || z.CMatrix() == nil || z.CMatrix().At(0, 0) != complex(1, -1) {
+		t.Errorf("Wrong companion %q: %v", "z", z)
+	}
+
+	// the main matrix is not complex
+	_, err = (&Matrix{}).ParseFileComplex(filepath.Join(dir, "test.tar.gz"))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected error %v, got: %v", ErrUnsupportedType, err)
+	}
+}
+
+func TestParseFileHarwellBoeing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exp, err := (&Matrix{}).ParseHarwellBoeing(strings.NewReader(hbRUA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, b := range map[string][]byte{
+		"test.rua":    []byte(hbRUA),
+		"test.rua.gz": gzipBytes(t, []byte(hbRUA)),
+	} {
+		file := writeTemp(t, dir, name, b)
+
+		matrix := &Matrix{}
+		got, err := matrix.ParseFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", name, err)
+		}
+		if !mat.Equal(exp, got) {
+			t.Errorf("Wrong content for %v: exp %v, got %v", name, mat.Formatted(exp), mat.Formatted(got))
+		}
+		if matrix.HarwellBoeing() == nil || len(matrix.RHS()) != 1 {
+			t.Errorf("Expected Harwell-Boeing header and right-hand side for %v", name)
+		}
+	}
+
+	// content starting with a comment is parsed as MatrixMarket
+	file := writeTemp(t, dir, "invalid.mtx", []byte("% comment\n"+fileMatrix))
+	if _, err := (&Matrix{}).ParseFile(file); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Expected error %v, got: %v", ErrInvalidHeader, err)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{name: "test.mtx.xz", b: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}},
+		{name: "test.mtx.zst", b: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}},
+		{name: "truncated.mtx.xz", b: xzBytes(t, []byte(fileMatrix))[:40]},
+		{name: "truncated.mtx.zst", b: zstdBytes(t, []byte(fileMatrix))[:20]},
+		{name: "empty.tar", b: tarBytes(t, []string{"README"}, map[string]string{"README": "no matrix"})},
+		{name: "invalid.tar", b: tarBytes(t, []string{"a/a.mtx"}, map[string]string{"a/a.mtx": "%%MatrixMarket"}), err: ErrInvalidHeader},
+		{name: "truncated.mtx.gz", b: gzipBytes(t, []byte(fileMatrix))[:20]},
+	}
+
+	for _, e := range entries {
+		file := writeTemp(t, dir, e.name, e.b)
+		_, err := (&Matrix{}).ParseFile(file)
+		if err == nil || (e.err != nil && !errors.Is(err, e.err)) {
+			t.Errorf("Expected error %v for %v, got: %v", e.err, e.name, err)
+		}
+	}
+
+	if _, err := (&Matrix{}).ParseFile(filepath.Join(dir, "missing.mtx")); !os.IsNotExist(err) {
+		t.Errorf("Expected error for missing file, got: %v", err)
+	}
+}
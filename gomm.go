@@ -1,28 +1,40 @@
-package main
+// Package gomm provides a parser for the MatrixMarket exchange format. Matrices
+// can be downloaded directly from the NIST MatrixMarket repository, or parsed
+// from any `io.Reader`, and are returned as `mat.Matrix` interfaces: dense
+// `*mat.Dense` for the array format, or `*mat.SymDense` for symmetric arrays,
+// and sparse `*sparse.CSR` for the coordinate format.
+package gomm
 
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"math"
-	"net/http"
-	"os"
+	"math/cmplx"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/james-bowman/sparse"
-	"github.com/jlaffaye/ftp"
 	"gonum.org/v1/gonum/mat"
 )
 
-// MatrixMarket remote URLs and FTP path.
+// MatrixMarket remote URLs and FTP root.
 const (
 	marketUrl  string = `http://math.nist.gov/MatrixMarket/matrices.html`
 	ftpDialUrl string = `math.nist.gov`
-	ftpPath    string = `pub/MatrixMarket2/%s/%s/%s.%s`
+	ftpRoot    string = `pub/MatrixMarket2`
+	httpsUrl   string = `https://math.nist.gov/pub/MatrixMarket2`
+)
+
+// Supported objects of the `MatrixMarket` format. Besides matrices, the
+// extended convention stores vectors, e.g. right-hand sides and solutions.
+const (
+	ObjectMatrix = "matrix"
+	ObjectVector = "vector"
 )
 
 // Supported formats for the MatrixMarket matrices.
@@ -34,16 +46,15 @@ const (
 // Possible value types for the `MatrixMarket` matrices.
 const (
 	TypeReal    = "real"
-	TypeInteger = "complex"
-	TypeComplex = "integer"
+	TypeInteger = "integer"
+	TypeComplex = "complex"
 	TypePattern = "pattern"
 )
 
 // Symmetry properties for the `MatrixMarket` matrices. For general matrices all
 // the non-zeroes are provided. For symmetric and skew-symmetric only the
-// lower-triangular (including the diagonal) is given.
-//
-// Note hermitian matrices are not yet supported.
+// lower-triangular (including the diagonal) is given. Hermitian matrices store
+// the lower-triangular part as well, the upper part is its complex conjugate.
 const (
 	General       = "general"
 	Symmetric     = "symmetric"
@@ -66,6 +77,7 @@ type Matrix struct {
 	collection string
 	set        string
 	name       string
+	Object     string
 	Format     string
 	Type       string
 	Symmetry   string
@@ -79,64 +91,137 @@ type Matrix struct {
 	nnz   int
 	lines int
 
+	// The number of explicitly stored zeros and the number of duplicate
+	// entries encountered while parsing.
+	zeros      int
+	duplicates int
+
+	// The lines holding non-finite values, when allowed.
+	nonFinite []int
+
+	// The header and optional vectors of matrices parsed from the
+	// Harwell-Boeing format.
+	hb                *HBHeader
+	rhs, guess, exact []mat.Vector
+
+	// The companion files of matrices parsed from a tar archive.
+	companions map[string]*Matrix
+
+	// The current line number while parsing, used to locate errors.
+	line int
+
 	mat mat.Matrix
+
+	// Matrices of `TypeComplex` are stored separately, as these do not
+	// satisfy the `mat.Matrix` interface.
+	cmat mat.CMatrix
+
+	// Options controls the behaviour of the parser.
+	Options ParseOptions
 }
 
+// ParseOptions controls the behaviour of the parser. The zero value provides
+// strict parsing.
+type ParseOptions struct {
+	// Lenient disables the validation of the entries of `FormatCoordinate`
+	// matrices: the number of entries may differ from the number declared
+	// in the size line, and entries with indices outside of the matrix
+	// dimensions are skipped instead of rejected.
+	Lenient bool
+
+	// Zeros selects whether explicitly stored zeros of `FormatCoordinate`
+	// matrices are dropped (default) or kept in the sparsity structure.
+	Zeros ZeroPolicy
+
+	// Duplicates selects how entries of `FormatCoordinate` matrices that
+	// share the same index are combined. By default these are summed.
+	Duplicates DuplicatePolicy
+
+	// Parallel enables parsing the entries of `FormatCoordinate` matrices
+	// on a pool of `GOMAXPROCS` workers, which also sort the entries of
+	// the rows when combining duplicates. The result, including any error,
+	// is identical to serial parsing. Complex matrices are always parsed
+	// serially.
+	Parallel bool
+
+	// MaxLineLength is the maximum length of a line in bytes, excluding the
+	// line ending. Longer lines are rejected with `ErrLineTooLong`. When
+	// zero, `DefaultMaxLineLength` is used.
+	MaxLineLength int
+
+	// NonFinite selects whether NaN and infinite values are rejected
+	// (default) or allowed.
+	NonFinite NonFinitePolicy
+}
+
+// DefaultMaxLineLength is the maximum length of a line used when the
+// `MaxLineLength` option is not set.
+const DefaultMaxLineLength = bufio.MaxScanTokenSize
+
+// ZeroPolicy determines how explicitly stored zeros of `FormatCoordinate`
+// matrices are treated.
+type ZeroPolicy int
+
+// Supported policies for explicit zeros. `DropZeros` omits the zero entries
+// from the resulting matrix, `KeepZeros` stores them as part of the sparsity
+// structure. In both cases the number of zeros is reported by
+// `Matrix.ExplicitZeros`.
+const (
+	DropZeros ZeroPolicy = iota
+	KeepZeros
+)
+
+// DuplicatePolicy determines how duplicate entries, i.e. entries sharing the
+// same index `(i, j)`, of `FormatCoordinate` matrices are treated. For
+// matrices with a symmetry the entries `(i, j)` and `(j, i)` are duplicates.
+type DuplicatePolicy int
+
+// Supported policies for duplicate entries. `SumDuplicates` adds all values,
+// as is common for assembled finite element matrices. `KeepFirstDuplicate`
+// and `KeepLastDuplicate` keep the value that appears first or last in the
+// file. `RejectDuplicates` fails with an `ErrDuplicateEntry` naming the lines
+// of both entries. The number of duplicates is reported by
+// `Matrix.Duplicates`.
+const (
+	SumDuplicates DuplicatePolicy = iota
+	KeepFirstDuplicate
+	KeepLastDuplicate
+	RejectDuplicates
+)
+
+// NonFinitePolicy determines how NaN and infinite values, e.g. `nan`, `inf`
+// or `-Inf`, are treated.
+type NonFinitePolicy int
+
+// Supported policies for non-finite values. `RejectNonFinite` fails with an
+// `ErrNonFinite` at the line of the value. `AllowNonFinite` stores the values
+// in the matrix and reports their lines by `Matrix.NonFinite`.
+const (
+	RejectNonFinite NonFinitePolicy = iota
+	AllowNonFinite
+)
+
 // GetMatrix gets a single matrix from the `MatrixMarket`. The routine requires
 // the collection, set, and name of the matrix and attempts to download and
 // parse the obtained document. On success a `mat.Matrix` interface is returned
 // that either contains a sparse or dense matrix depending on the matrix's type.
+// The matrix is downloaded by the `DefaultClient`, see `Client.GetMatrix`.
 func GetMatrix(collection, set, name string) (mat.Matrix, error) {
-	matrix := NewMatrix(collection, set, name)
-	if err := matrix.Download(); err != nil {
-		return nil, err
-	}
-
-	f, err := os.Open(matrix.Filename())
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	rd, err := gzip.NewReader(f)
-	if err != nil {
-		return nil, err
-	}
-
-	mat, err := matrix.Parse(rd)
-	if err != nil {
-		return nil, err
-	}
+	return DefaultClient.GetMatrix(context.Background(), collection, set, name)
+}
 
-	return mat, nil
+// GetComplexMatrix gets a single matrix of `TypeComplex` from the
+// `MatrixMarket`. It behaves as `GetMatrix`, but returns a `mat.CMatrix`
+// interface that either contains a `*ComplexCSR` or a `*mat.CDense`.
+func GetComplexMatrix(collection, set, name string) (mat.CMatrix, error) {
+	return DefaultClient.GetComplexMatrix(context.Background(), collection, set, name)
 }
 
 // NewMatrixMarket creates a local representation of the `MatrixMarket`. It
-// forms a list of all available matrices from the `/MatrixMarket/data/` page.
+// forms a list of all available matrices from the `/MatrixMarket/data/` page,
+// using the `DefaultClient`.
 func NewMatrixMarket() (*MatrixMarket, error) {
-	list, err := GetMatrixMarket()
-	if err != nil {
-		return nil, err
-	}
-	defer list.Close()
-
-	market := new(MatrixMarket)
-
-	scanner := bufio.NewScanner(list)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, `<A HREF="/MatrixMarket/data/`) {
-			m, err := ParseEntry(line)
-			if err != nil {
-				log.Printf("Failed to parse: %#v\n", line)
-			}
-			market.Matrices = append(market.Matrices, m)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	return market, nil
+	return DefaultClient.NewMatrixMarket(context.Background())
 }
 
 // NewMatrix provides a `Matrix` struct initialised with a collection, set, and
@@ -145,6 +230,28 @@ func NewMatrix(collection, set, name string) Matrix {
 	return Matrix{collection: collection, set: set, name: name}
 }
 
+// Collection returns the name of the collection the matrix belongs to, e.g.
+// `Harwell-Boeing`.
+func (matrix *Matrix) Collection() string {
+	return matrix.collection
+}
+
+// MatrixSet returns the name of the set within the collection, e.g.
+// `bcsstruc1`.
+func (matrix *Matrix) MatrixSet() string {
+	return matrix.set
+}
+
+// Name returns the name of the matrix, e.g. `bcsstk01`.
+func (matrix *Matrix) Name() string {
+	return matrix.name
+}
+
+// Comment returns the comment lines that were encountered while parsing.
+func (matrix *Matrix) Comment() string {
+	return matrix.comment
+}
+
 // Dims returns the dimensions of the matrix `(rows, cols)`.
 func (matrix *Matrix) Dims() (int, int) {
 	return matrix.n, matrix.m
@@ -155,11 +262,37 @@ func (matrix *Matrix) At(i, j int) float64 {
 	return matrix.mat.At(i, j)
 }
 
+// CMatrix returns the parsed matrix of `TypeComplex`, or nil for other types.
+func (matrix *Matrix) CMatrix() mat.CMatrix {
+	return matrix.cmat
+}
+
 // NNZ returns the number of non-zeroes of the matrix.
 func (matrix *Matrix) NNZ() int {
 	return matrix.nnz
 }
 
+// Duplicates returns the number of duplicate entries encountered while parsing
+// a `FormatCoordinate` matrix, i.e. the number of entries that repeat the index
+// of a previous entry. These are combined according to
+// `ParseOptions.Duplicates`.
+func (matrix *Matrix) Duplicates() int {
+	return matrix.duplicates
+}
+
+// ExplicitZeros returns the number of explicitly stored zeros encountered
+// while parsing a `FormatCoordinate` matrix. Depending on `ParseOptions.Zeros`
+// these are dropped or kept in the matrix.
+func (matrix *Matrix) ExplicitZeros() int {
+	return matrix.zeros
+}
+
+// NonFinite returns the lines holding NaN or infinite values encountered while
+// parsing, in case these are allowed by `ParseOptions.NonFinite`.
+func (matrix *Matrix) NonFinite() []int {
+	return matrix.nonFinite
+}
+
 // Filename forms the filename of the matrix. Currently, the code only processes
 // the `MatrixMarket` format and the extensions are hardcoded to `.mtx.gz`.
 func (matrix *Matrix) Filename() string {
@@ -171,13 +304,10 @@ func (market *MatrixMarket) Download(m Matrix) error {
 	return m.Download()
 }
 
-// GetMatrixMarket reads the body of the response for a matrix request.
+// GetMatrixMarket reads the body of the response for a matrix request, using
+// the `DefaultClient`.
 func GetMatrixMarket() (io.ReadCloser, error) {
-	resp, err := http.Get(marketUrl)
-	if err != nil {
-		return nil, err
-	}
-	return resp.Body, nil
+	return DefaultClient.GetMatrixMarket(context.Background())
 }
 
 // ParseEntry parses a single entry in the list of `MatrixMarket` matrices and
@@ -198,34 +328,26 @@ func ParseEntry(line string) (Matrix, error) {
 	}, nil
 }
 
-// Download a single matrix to disk. This stores the matrix as a `gz` compressed
-// file.
+// Download a single matrix to disk using the `DefaultClient`. This stores the
+// matrix as a `gz` compressed file, named by `Filename`, in the current
+// working directory. See `Cache` to avoid downloading the same matrix
+// repeatedly.
 func (matrix *Matrix) Download() error {
-	c, err := ftp.Dial(ftpDialUrl + `:21`)
-	if err != nil {
-		return err
-	}
-
-	err = c.Login("anonymous", "anonymous")
-	if err != nil {
-		return err
-	}
+	return DefaultClient.Download(context.Background(), matrix, matrix.Filename())
+}
 
-	// TODO can be harwell-boeing or matrixmarket format...
-	f, err := c.Retr(fmt.Sprintf(ftpPath, matrix.collection, matrix.set, matrix.name, "mtx.gz"))
+// download downloads the matrix by the fetcher to the file at the given path,
+// which is replaced only once the download completes, see `writeFile`. The
+// size of the download is verified against the size reported by the fetcher,
+// if any.
+func (matrix *Matrix) download(ctx context.Context, fetcher Fetcher, path string) (ManifestEntry, error) {
+	f, size, err := fetcher.Fetch(ctx, matrix.remotePath())
 	if err != nil {
-		return err
+		return ManifestEntry{}, err
 	}
 	defer f.Close()
 
-	file, err := os.Create(fmt.Sprintf("%s.mtx.gz", matrix.name))
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, f)
-	return err
+	return writeFile(path, f, size)
 }
 
 // Path returns the formatted path of the matrix.
@@ -244,27 +366,40 @@ func (matrix *Matrix) String() string {
 // extracts the first line from the provided `Reader`.
 func (matrix *Matrix) ParseHeader(buf *bufio.Reader) error {
 	// read first line
-	b, err := buf.ReadBytes('\n')
+	matrix.line = 1
+	b, err := matrix.readLine(buf)
 	if err != nil {
 		if err != io.EOF {
-			return err
+			return matrix.parseError(SectionHeader, string(b), err)
+		}
+		if len(b) == 0 {
+			return matrix.parseError(SectionHeader, "", ErrUnexpectedEOF)
 		}
 	}
-	tokens := strings.Split(strings.TrimSpace(string(b)), " ")
+	line := string(b)
+	tokens := strings.Fields(line)
 
 	// for 'matrix' objects we expect four tokens in the header
 	if len(tokens) != 5 {
-		return fmt.Errorf("Wrong number of header tokens: %#v (%d), exp: 5", tokens, len(tokens))
+		err := fmt.Errorf("%w: wrong number of header tokens: %d, exp: 5", ErrInvalidHeader, len(tokens))
+		return matrix.parseError(SectionHeader, line, err)
 	}
 
 	// start header
 	if !strings.EqualFold(tokens[0], "%%MatrixMarket") {
-		return fmt.Errorf("Expected header '%%MatrixMarket', got %s", tokens[0])
+		err := fmt.Errorf("%w: expected '%%%%MatrixMarket', got %s", ErrInvalidHeader, tokens[0])
+		return matrix.parseError(SectionHeader, line, err)
 	}
 
 	// object
-	if !strings.EqualFold(tokens[1], "matrix") {
-		return fmt.Errorf("Unsupported object: %v, expected 'matrix'", tokens[1])
+	switch strings.ToLower(tokens[1]) {
+	case ObjectMatrix:
+		matrix.Object = ObjectMatrix
+	case ObjectVector:
+		matrix.Object = ObjectVector
+	default:
+		err := fmt.Errorf("%w: %v, expected 'matrix' or 'vector'", ErrUnsupportedObject, tokens[1])
+		return matrix.parseError(SectionHeader, line, err)
 	}
 
 	// format
@@ -274,7 +409,8 @@ func (matrix *Matrix) ParseHeader(buf *bufio.Reader) error {
 	case FormatCoordinate:
 		matrix.Format = FormatCoordinate
 	default:
-		return fmt.Errorf("Unsupported format: %v", tokens[2])
+		err := fmt.Errorf("%w: %v", ErrUnsupportedFormat, tokens[2])
+		return matrix.parseError(SectionHeader, line, err)
 	}
 
 	// element type
@@ -282,13 +418,14 @@ func (matrix *Matrix) ParseHeader(buf *bufio.Reader) error {
 	case TypeReal:
 		matrix.Type = TypeReal // float64
 	case TypeComplex:
-		matrix.Type = TypeComplex // complex?!
+		matrix.Type = TypeComplex // complex128
 	case TypeInteger:
 		matrix.Type = TypeInteger // int
 	case TypePattern:
 		matrix.Type = TypePattern // bool
 	default:
-		return fmt.Errorf("Unsupported format: %v", tokens[3])
+		err := fmt.Errorf("%w: %v", ErrUnsupportedType, tokens[3])
+		return matrix.parseError(SectionHeader, line, err)
 	}
 
 	// matrix type
@@ -302,7 +439,20 @@ func (matrix *Matrix) ParseHeader(buf *bufio.Reader) error {
 	case Hermitian:
 		matrix.Symmetry = Hermitian
 	default:
-		return fmt.Errorf("Unsupported matrix symmetry: %v", tokens[4])
+		err := fmt.Errorf("%w: %v", ErrUnsupportedSymmetry, tokens[4])
+		return matrix.parseError(SectionHeader, line, err)
+	}
+
+	// vectors are real valued and have no symmetry
+	if matrix.Object == ObjectVector {
+		if matrix.Type == TypeComplex {
+			err := fmt.Errorf("%w: %#v is not supported for %#v objects", ErrUnsupportedType, TypeComplex, ObjectVector)
+			return matrix.parseError(SectionHeader, line, err)
+		}
+		if matrix.Symmetry != General {
+			err := fmt.Errorf("%w: %#v is not supported for %#v objects", ErrUnsupportedSymmetry, matrix.Symmetry, ObjectVector)
+			return matrix.parseError(SectionHeader, line, err)
+		}
 	}
 
 	return nil
@@ -318,21 +468,22 @@ func (matrix *Matrix) ParseComment(buf *bufio.Reader) error {
 loop:
 	for {
 		// EOF is not an error; should just terminate
-		b, err := buf.Peek(1)
+		c, err := peekNonSpace(buf)
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || err == bufio.ErrBufferFull {
 				break loop
 			}
-			return err
+			return matrix.parseError(SectionComment, "", err)
 		}
 
-		switch b[0] {
-		case '%', '\n', ' ', '\t':
+		switch c {
+		case '%', '\n':
 			// consume and store comment and empty lines
-			b, err := buf.ReadBytes('\n')
+			matrix.line++
+			b, err := matrix.readLine(buf)
 			if err != nil {
 				if err != io.EOF {
-					return err
+					return matrix.parseError(SectionComment, string(b), err)
 				}
 			}
 			comment.Write(b)
@@ -349,31 +500,49 @@ loop:
 
 // ParseDimensions parses the dimensions and expected number of lines.
 func (matrix *Matrix) ParseDimensions(buf *bufio.Reader) error {
-	line, err := buf.ReadString('\n')
+	matrix.line++
+	b, err := matrix.readLine(buf)
+	line := string(b)
 	if err != nil {
-		return err
+		if err != io.EOF {
+			return matrix.parseError(SectionSize, line, err)
+		}
+		if len(line) == 0 {
+			return matrix.parseError(SectionSize, "", ErrUnexpectedEOF)
+		}
 	}
 
-	dims := strings.Split(strings.TrimSpace(line), " ")
+	dims := strings.Fields(line)
+	if matrix.Object == ObjectVector {
+		return matrix.parseVectorDimensions(line, dims)
+	}
 	if len(dims) < 2 {
-		return fmt.Errorf("Expect at least two values: (n, m, _), got: %v", dims)
+		err := fmt.Errorf("%w: expect at least two values: (n, m, _), got: %v", ErrInvalidSize, dims)
+		return matrix.parseError(SectionSize, line, err)
 	}
 
 	n, err := strconv.Atoi(dims[0])
 	if err != nil {
-		return err
+		return matrix.parseError(SectionSize, line, err)
 	}
 	matrix.n = n
 
 	m, err := strconv.Atoi(dims[1])
 	if err != nil {
-		return err
+		return matrix.parseError(SectionSize, line, err)
 	}
 	matrix.m = m
 
+	if err := checkDims(n, m); err != nil {
+		return matrix.parseError(SectionSize, line, err)
+	}
+	if err := checkSquare(matrix.Symmetry, n, m); err != nil {
+		return matrix.parseError(SectionSize, line, err)
+	}
+
 	// `FormatArray` is dense, thus the number of lines is already known
 	if matrix.Format == FormatArray {
-		matrix.lines = matrix.n * matrix.m
+		matrix.lines = arrayLength(n, m, matrix.Symmetry)
 		return nil
 	}
 
@@ -381,16 +550,68 @@ func (matrix *Matrix) ParseDimensions(buf *bufio.Reader) error {
 	// triplets are to be summed, or only a subset of symmetric matrices
 	// are provided. Thus the number of expected lines is parsed.
 	if len(dims) < 3 {
-		return fmt.Errorf("Expect at least three values: (n, m, v), got: %v", dims)
+		err := fmt.Errorf("%w: expect at least three values: (n, m, v), got: %v", ErrInvalidSize, dims)
+		return matrix.parseError(SectionSize, line, err)
 	}
 	lines, err := strconv.Atoi(dims[2])
 	if err != nil {
-		return err
+		return matrix.parseError(SectionSize, line, err)
+	}
+	if err := checkLines(lines); err != nil {
+		return matrix.parseError(SectionSize, line, err)
 	}
 	matrix.lines = lines
 	return nil
 }
 
+// maxInt is the largest value of an `int`.
+const maxInt = int(^uint(0) >> 1)
+
+// checkDims validates the dimensions of the size line: both should be
+// positive, and the number of values `n*m` should fit an `int`.
+func checkDims(n, m int) error {
+	if n < 1 || m < 1 {
+		return fmt.Errorf("%w: dimensions should be positive, got (%d, %d)", ErrInvalidSize, n, m)
+	}
+	if n > maxInt/m {
+		return fmt.Errorf("%w: dimensions (%d, %d) exceed the number of addressable values", ErrInvalidSize, n, m)
+	}
+	return nil
+}
+
+// checkSquare validates that matrices with a symmetry other than `General`
+// are square, as their entries are mirrored.
+func checkSquare(symmetry string, n, m int) error {
+	if symmetry != General && symmetry != "" && n != m {
+		return fmt.Errorf("%w: matrix of symmetry %#v should be square, got: (%d, %d)", ErrInvalidSize, symmetry, n, m)
+	}
+	return nil
+}
+
+// checkLines validates the number of entries of the size line of a
+// `FormatCoordinate` matrix. This may exceed the number of values `n*m`, as
+// duplicate entries are combined.
+func checkLines(lines int) error {
+	if lines < 0 {
+		return fmt.Errorf("%w: number of entries %d should not be negative", ErrInvalidSize, lines)
+	}
+	return nil
+}
+
+// maxPrealloc limits the storage that is allocated up front from the counts of
+// the size line, such that a corrupt size line cannot exhaust the memory.
+// Storage of larger matrices grows while parsing.
+const maxPrealloc = 1 << 20
+
+// preallocSize returns the capacity to allocate for the given number of
+// values, at most `maxPrealloc`.
+func preallocSize(size int) int {
+	if size > maxPrealloc {
+		return maxPrealloc
+	}
+	return size
+}
+
 // ParseMatrix performs the parsing of the body of the matrix. This routine
 // invokes a specialised routine, depending on the matrix format, to perform
 // the actual parsing.
@@ -401,29 +622,81 @@ func (matrix *Matrix) ParseMatrix(buf *bufio.Reader) error {
 	case FormatArray:
 		return matrix.ParseArrayFormat(buf)
 	default:
-		return fmt.Errorf("not supported format %#v", matrix.Format)
+		err := fmt.Errorf("%w: %#v", ErrUnsupportedFormat, matrix.Format)
+		return matrix.parseError(SectionData, "", err)
+	}
+}
+
+// parseValue parses a single value of the given value type. Values of
+// `TypeInteger` are required to be integers, these are rejected otherwise.
+// The value is parsed without allocating, see `parseFloat`.
+func parseValue(b []byte, typ string) (float64, error) {
+	if typ == TypeInteger {
+		v, err := parseInt64(b)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid value for type %#v: %w", TypeInteger, err)
+		}
+		return float64(v), nil
+	}
+	return parseFloat(b)
+}
+
+// splitFields splits the bytes in exactly `n`, at most three, white space
+// separated fields. Other numbers of fields are rejected.
+func splitFields(b []byte, n int) (splits [3][]byte, err error) {
+	k, rest := 0, b
+	for ; k < n; k++ {
+		if splits[k], rest = nextField(rest); len(splits[k]) == 0 {
+			break
+		}
+	}
+	if extra, _ := nextField(rest); k != n || len(extra) > 0 {
+		return splits, fmt.Errorf("%w: wrong number of values to unpack entry %d, exp %d", ErrInvalidEntry, countFields(b), n)
 	}
+	return splits, nil
 }
 
-// splitTriplet splits a COO-triplet of (i, j, v) form from strings to two
-// integer indices (i, j) and the matching floating point value (v).
-func splitTriplet(s string) (i int, j int, v float64, err error) {
-	splits := strings.Fields(strings.TrimSpace(s))
-	if len(splits) != 3 {
-		return i, j, v, fmt.Errorf("Too little entries to unpack triplet %d, %s", len(splits), splits)
+// splitEntry splits an entry of a `FormatCoordinate` matrix, or vector, into
+// its one-based index (i, j) and value. Entries of vectors only hold the row
+// index, for these the column index is set to one.
+func splitEntry(b []byte, object, typ string) (int, int, float64, error) {
+	if object == ObjectVector {
+		i, v, err := splitVectorEntry(b, typ)
+		return i, 1, v, err
 	}
+	return splitTriplet(b, typ)
+}
 
-	i, err = strconv.Atoi(splits[0])
+// splitTriplet splits a COO-triplet of (i, j, v) form from bytes to two
+// integer indices (i, j) and the matching value (v) of the given value type.
+// Entries of `TypePattern` only hold the indices (i, j), for these the value
+// is set to one. The triplet is parsed without allocating.
+func splitTriplet(b []byte, typ string) (i int, j int, v float64, err error) {
+	fields := 3
+	if typ == TypePattern {
+		fields = 2
+	}
+
+	splits, err := splitFields(b, fields)
 	if err != nil {
 		return i, j, v, err
 	}
 
-	j, err = strconv.Atoi(splits[1])
+	i, err = parseInt(splits[0])
 	if err != nil {
 		return i, j, v, err
 	}
 
-	v, err = strconv.ParseFloat(splits[2], 64)
+	j, err = parseInt(splits[1])
+	if err != nil {
+		return i, j, v, err
+	}
+
+	if typ == TypePattern {
+		return i, j, 1.0, nil
+	}
+
+	v, err = parseValue(splits[2], typ)
 	if err != nil {
 		return i, j, v, err
 	}
@@ -431,187 +704,910 @@ func splitTriplet(s string) (i int, j int, v float64, err error) {
 	return i, j, v, nil
 }
 
-// ParseCoordinate parses a `MatrixMarket` of the `Coordinate` format.
+// checkEntry validates the `k`-th entry `(i, j)`, with one-based indices, of
+// a `FormatCoordinate` matrix. It returns whether the entry should be inserted
+// in the matrix. In strict mode invalid entries result in an error, for the
+// `Lenient` option these are skipped.
+func (matrix *Matrix) checkEntry(k, i, j int) (bool, error) {
+	if !matrix.Options.Lenient && k > matrix.lines {
+		return false, fmt.Errorf("%w: exp %d", ErrTooManyEntries, matrix.lines)
+	}
+
+	var err error
+	switch {
+	case i == 0 || j == 0:
+		err = fmt.Errorf("%w: entry %d: index (%d, %d) is zero, indices are one-based", ErrIndexOutOfRange, k, i, j)
+	case i < 1 || i > matrix.n || j < 1 || j > matrix.m:
+		err = fmt.Errorf("%w: entry %d: index (%d, %d) exceeds (%d, %d)", ErrIndexOutOfRange, k, i, j, matrix.n, matrix.m)
+	}
+	if err != nil {
+		if matrix.Options.Lenient {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// checkFinite validates a value parsed from the current line against the
+// `NonFinite` policy. Allowed non-finite values are recorded by their line.
+func (matrix *Matrix) checkFinite(v complex128) error {
+	if !cmplx.IsNaN(v) && !cmplx.IsInf(v) {
+		return nil
+	}
+	if matrix.Options.NonFinite == AllowNonFinite {
+		matrix.nonFinite = append(matrix.nonFinite, matrix.line)
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrNonFinite, v)
+}
+
+// checkEntries validates the number of entries parsed for a `FormatCoordinate`
+// matrix against the number declared in the size line.
+func (matrix *Matrix) checkEntries(entries int) error {
+	if !matrix.Options.Lenient && entries != matrix.lines {
+		err := fmt.Errorf("%w: got %d entries, exp %d", ErrUnexpectedEOF, entries, matrix.lines)
+		return matrix.parseError(SectionData, "", err)
+	}
+	return nil
+}
+
+// groupEntries groups the entries of a `FormatCoordinate` matrix by their
+// index `(I[k], J[k])`. The function `fn` is called for each group with the
+// positions of its entries in order of appearance. Groups holding more than a
+// single entry are counted as duplicates, and rejected for `RejectDuplicates`
+// with an error referring to the lines of the entries.
+func (matrix *Matrix) groupEntries(I, J, lines []int, fn func(group []int)) error {
+	workers := 1
+	if matrix.Options.Parallel {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	perm := sortEntries(matrix.n, I, J, workers)
+
+	for start := 0; start < len(perm); {
+		end := start + 1
+		for end < len(perm) && I[perm[end]] == I[perm[start]] && J[perm[end]] == J[perm[start]] {
+			end++
+		}
+		group := perm[start:end]
+		start = end
+
+		if len(group) > 1 {
+			matrix.duplicates += len(group) - 1
+			if matrix.Options.Duplicates == RejectDuplicates {
+				first, second := group[0], group[1]
+				return &ParseError{
+					Line:    lines[second],
+					Section: SectionData,
+					Err: fmt.Errorf("%w: index (%d, %d) on lines %d and %d", ErrDuplicateEntry,
+						I[first]+1, J[first]+1, lines[first], lines[second]),
+				}
+			}
+		}
+		fn(group)
+	}
+	return nil
+}
+
+// sortEntries returns the positions of the entries `(I[k], J[k])` sorted by
+// row, column, and position. The entries are distributed over the `n` rows by
+// a counting sort, preserving their order of appearance, after which the
+// entries of each row are sorted by column on the given number of workers.
+func sortEntries(n int, I, J []int, workers int) []int {
+	perm := make([]int, len(I))
+	if n > len(I) {
+		// avoid allocating for empty rows, sort all entries at once
+		for k := range perm {
+			perm[k] = k
+		}
+		sort.Sort(entryOrder{I: I, J: J, perm: perm})
+		return perm
+	}
+
+	ptr := make([]int, n+1)
+	for _, i := range I {
+		ptr[i+1]++
+	}
+	for i := 0; i < n; i++ {
+		ptr[i+1] += ptr[i]
+	}
+	next := append([]int(nil), ptr[:n]...)
+	for k, i := range I {
+		perm[next[i]] = k
+		next[i]++
+	}
+
+	sortRows(I, J, perm, ptr, workers)
+	return perm
+}
+
+// entryOrder sorts the positions `perm` of entries `(I[k], J[k])` by row,
+// column, and position.
+type entryOrder struct {
+	I, J, perm []int
+}
+
+func (e entryOrder) Len() int      { return len(e.perm) }
+func (e entryOrder) Swap(a, b int) { e.perm[a], e.perm[b] = e.perm[b], e.perm[a] }
+func (e entryOrder) Less(a, b int) bool {
+	ka, kb := e.perm[a], e.perm[b]
+	if e.I[ka] != e.I[kb] {
+		return e.I[ka] < e.I[kb]
+	}
+	if e.J[ka] != e.J[kb] {
+		return e.J[ka] < e.J[kb]
+	}
+	return ka < kb
+}
+
+// selectEntries returns the positions, out of a group of entries sharing the
+// same index, whose values are summed to form the matrix entry.
+func (matrix *Matrix) selectEntries(group []int) []int {
+	switch matrix.Options.Duplicates {
+	case KeepFirstDuplicate:
+		return group[:1]
+	case KeepLastDuplicate:
+		return group[len(group)-1:]
+	default:
+		return group
+	}
+}
+
+// triplets holds the entries of a `FormatCoordinate` matrix in order of
+// appearance, with zero-based indices and the line numbers the entries
+// originate from.
+type triplets struct {
+	I, J  []int
+	V     []float64
+	lines []int
+}
+
+// newTriplets allocates storage for the given number of triplets, limited to
+// `maxPrealloc`.
+func newTriplets(size int) *triplets {
+	size = preallocSize(size)
+	return &triplets{
+		I:     make([]int, 0, size),
+		J:     make([]int, 0, size),
+		V:     make([]float64, 0, size),
+		lines: make([]int, 0, size),
+	}
+}
+
+// addEntry validates the `k`-th entry `(i, j, v)`, with one-based indices,
+// that is parsed from the current line, and appends it to the triplets.
+// Entries that are skipped in lenient mode are not appended.
+func (matrix *Matrix) addEntry(t *triplets, k, i, j int, v float64) error {
+	if ok, err := matrix.checkEntry(k, i, j); !ok {
+		return err
+	}
+	if err := matrix.checkFinite(complex(v, 0)); err != nil {
+		return err
+	}
+
+	if v == 0 {
+		matrix.zeros++
+	}
+
+	// correct for one-base
+	t.I, t.J, t.V = append(t.I, i-1), append(t.J, j-1), append(t.V, v)
+	t.lines = append(t.lines, matrix.line)
+	return nil
+}
+
+// ParseCoordinate parses a `MatrixMarket` of the `Coordinate` format. With the
+// `Parallel` option the lines are parsed concurrently, see `parseParallel`.
 func (matrix *Matrix) ParseCoordinate(buf *bufio.Reader) error {
-	// fill COO
+	if matrix.Type == TypeComplex {
+		return matrix.parseComplexCoordinate(buf)
+	}
+
 	n, m := matrix.Dims()
 	if n == 0 || m == 0 {
-		return fmt.Errorf("Matrix dimensions are empty (%d, %d)", n, m)
+		err := fmt.Errorf("%w: matrix dimensions are empty (%d, %d)", ErrInvalidSize, n, m)
+		return matrix.parseError(SectionSize, "", err)
 	}
 
+	var t *triplets
+	var err error
+	if matrix.Options.Parallel {
+		t, err = matrix.parseParallel(buf)
+	} else {
+		t, err = matrix.parseSerial(buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	return matrix.assemble(t)
+}
+
+// parseSerial parses all lines of a `FormatCoordinate` matrix into triplets.
+func (matrix *Matrix) parseSerial(buf *bufio.Reader) (*triplets, error) {
 	// estimate number of non-zeros by number of lines in file
-	nnz := matrix.lines
-	I, J, V := make([]int, 0, nnz), make([]int, 0, nnz), make([]float64, 0, nnz)
-	coo := sparse.NewCOO(n, m, I, J, V)
+	t := newTriplets(matrix.lines)
 
 	// exhaust all lines with scanner
-	scanner := bufio.NewScanner(buf)
+	scanner := matrix.newScanner(buf)
+	entries := 0
 	for scanner.Scan() {
-		i, j, v, err := splitTriplet(scanner.Text())
+		matrix.line++
+		line := scanner.Bytes()
+		if isBlank(line) {
+			continue
+		}
+		i, j, v, err := splitEntry(line, matrix.Object, matrix.Type)
 		if err != nil {
-			return err
+			return nil, matrix.parseError(SectionData, string(line), err)
 		}
 
-		// prevent inserting explicit zeros
-		// FIXME: not sure if `SmallestNonzeroFloat64` makes sense
-		if math.Abs(v) < math.SmallestNonzeroFloat64 {
-			continue
+		entries++
+		if err := matrix.addEntry(t, entries, i, j, v); err != nil {
+			return nil, matrix.parseError(SectionData, string(line), err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, matrix.scanError(SectionData, err)
+	}
+	if err := matrix.checkEntries(entries); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// assemble forms the CSR matrix from the parsed triplets, after combining
+// duplicates and expanding the symmetry.
+func (matrix *Matrix) assemble(t *triplets) error {
+	if matrix.Object == ObjectVector {
+		return matrix.assembleVector(t)
+	}
+
+	n, m := matrix.Dims()
+	nnz := len(t.V)
+
+	// entries of the upper triangle are stored as their lower counterpart,
+	// such that these are combined with duplicates of the lower triangle
+	if matrix.Symmetry != General {
+		for k := range t.V {
+			if t.I[k] >= t.J[k] {
+				continue
+			}
+			t.I[k], t.J[k] = t.J[k], t.I[k]
+			if matrix.Symmetry == SkewSymmetric {
+				t.V[k] = -t.V[k]
+			}
+		}
+	}
+
+	// fill COO, after combining duplicates
+	coo := sparse.NewCOO(n, m, make([]int, 0, nnz), make([]int, 0, nnz), make([]float64, 0, nnz))
+	err := matrix.groupEntries(t.I, t.J, t.lines, func(group []int) {
+		v := 0.0
+		for _, k := range matrix.selectEntries(group) {
+			v += t.V[k]
 		}
 
-		// correct for one-base
-		coo.Set(i-1, j-1, v)
+		// explicit zeros are only inserted on request
+		if v == 0 && matrix.Options.Zeros == DropZeros {
+			return
+		}
+
+		i, j := t.I[group[0]], t.J[group[0]]
+		coo.Set(i, j, v)
 
 		// for symmetric types also insert its symmetric counterpart
 		if i != j {
 			switch matrix.Symmetry {
-			case Symmetric:
-				coo.Set(j-1, i-1, v)
+			case Symmetric, Hermitian:
+				coo.Set(j, i, v)
 			case SkewSymmetric:
-				coo.Set(j-1, i-1, -v)
+				coo.Set(j, i, -v)
 			}
 		}
-	}
-	if err := scanner.Err(); err != nil {
+	})
+	if err != nil {
 		return err
 	}
 
 	// return CSR
-	matrix.mat = coo.ToCSR()
+	csr := coo.ToCSR()
+	matrix.mat = csr
+	matrix.nnz = csr.NNZ()
 	return nil
 }
 
 // ParseArrayFormat parses a `MatrixMarket` of format `Array`.
 func (matrix *Matrix) ParseArrayFormat(buf *bufio.Reader) error {
+	switch matrix.Type {
+	case TypeComplex:
+		return matrix.parseComplexArray(buf)
+	case TypePattern:
+		err := fmt.Errorf("%w: %#v is not supported for format %#v", ErrUnsupportedType, TypePattern, FormatArray)
+		return matrix.parseError(SectionHeader, "", err)
+	}
+
 	// prepare dense matrix
 	n, m := matrix.Dims()
 	if n == 0 || m == 0 {
-		return fmt.Errorf("Matrix dimensions are empty (%d, %d)", n, m)
+		err := fmt.Errorf("%w: matrix dimensions are empty (%d, %d)", ErrInvalidSize, n, m)
+		return matrix.parseError(SectionSize, "", err)
 	}
 
-	//mat := mat.NewDense(n, m, nil)
-	values := make([]float64, n*m)
+	size := arrayLength(n, m, matrix.Symmetry)
+	values := make([]float64, 0, preallocSize(size))
 
 	// exhaust all lines with scanner
-	scanner := bufio.NewScanner(buf)
-	cnt := 0
+	scanner := matrix.newScanner(buf)
 	for scanner.Scan() {
-		v, err := strconv.ParseFloat(strings.TrimSpace(scanner.Text()), 64)
+		matrix.line++
+		line := scanner.Bytes()
+		if isBlank(line) {
+			continue
+		}
+		v, err := parseValue(bytes.TrimSpace(line), matrix.Type)
 		if err != nil {
-			return err
+			return matrix.parseError(SectionData, string(line), err)
+		}
+		if len(values) == size {
+			err := fmt.Errorf("%w: exp %d for matrix of dimensions (%d, %d)", ErrTooManyEntries, size, n, m)
+			return matrix.parseError(SectionData, string(line), err)
+		}
+		if err := matrix.checkFinite(complex(v, 0)); err != nil {
+			return matrix.parseError(SectionData, string(line), err)
 		}
+		values = append(values, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return matrix.scanError(SectionData, err)
+	}
+	if len(values) != size {
+		err := fmt.Errorf("%w: got %d entries, exp %d", ErrUnexpectedEOF, len(values), size)
+		return matrix.parseError(SectionData, "", err)
+	}
+
+	if matrix.Object == ObjectVector {
+		matrix.mat = mat.NewVecDense(n, values)
+		return nil
+	}
 
-		values[cnt] = v
-		cnt++
+	// Construct a matrix where the extracted values are put in the right
+	// order, as the ordering of `MatrixMarket` is column-major, whereas
+	// `mat.NewDense` would assume row-major.
+	switch matrix.Symmetry {
+	case Symmetric, Hermitian:
+		sym := mat.NewSymDense(n, nil)
+		doArrayEntry(n, m, matrix.Symmetry, func(k, r, c int) {
+			sym.SetSym(r, c, values[k])
+		})
+		matrix.mat = sym
+	default:
+		mm := mat.NewDense(n, m, nil)
+		doArrayEntry(n, m, matrix.Symmetry, func(k, r, c int) {
+			mm.Set(r, c, values[k])
+			if matrix.Symmetry == SkewSymmetric {
+				mm.Set(c, r, -values[k])
+			}
+		})
+		matrix.mat = mm
 	}
+	return nil
+}
 
-	// Construct a dense matrix where the extracted values are put in the
-	// right order, as the ordering of `MatrixMarket` is column-major,
-	// whereas `mat.NewDense` would assume row-major.
-	mm := mat.NewDense(n, m, nil)
+// arrayLength returns the number of values stored for a matrix in
+// `FormatArray`. General matrices store all values, for (skew-)symmetric and
+// hermitian matrices only the lower-triangular part is provided.
+func arrayLength(n, m int, symmetry string) int {
+	switch symmetry {
+	case Symmetric, Hermitian:
+		return n * (n + 1) / 2
+	case SkewSymmetric:
+		return n * (n - 1) / 2
+	default:
+		return n * m
+	}
+}
+
+// doArrayEntry calls the function `fn` for each stored value of a matrix in
+// `FormatArray`, with the value's index `k` and its position `(r, c)` in the
+// matrix. The values are visited in column-major order, for (skew-)symmetric
+// and hermitian matrices only the lower-triangular part is visited. The
+// diagonal is omitted for skew-symmetric matrices as it is zero.
+func doArrayEntry(n, m int, symmetry string, fn func(k, r, c int)) {
+	k := 0
 	for c := 0; c < m; c++ {
-		for r := 0; r < n; r++ {
-			mm.Set(r, c, values[c*n+r])
+		for r := arrayStart(c, symmetry); r < n; r++ {
+			fn(k, r, c)
+			k++
 		}
 	}
-	matrix.mat = mm
-	return nil
+}
+
+// arrayStart returns the first row of column `c` that is stored for a matrix
+// in `FormatArray` with the given symmetry.
+func arrayStart(c int, symmetry string) int {
+	switch symmetry {
+	case Symmetric, Hermitian:
+		return c
+	case SkewSymmetric:
+		return c + 1
+	default:
+		return 0
+	}
 }
 
 // Parse parses the matrix form a `Reader` by parsing the header, comment,
 // dimensions, and finally the body of the matrix. The parsed information is
 // stored in the matrix. If all steps complete without error the matrix
-// interface is returned.
+// interface is returned. Matrices of `TypeComplex` should be parsed with
+// `ParseComplex` instead. Vector objects are returned as a single column, see
+// `ParseVector`.
 func (matrix *Matrix) Parse(rd io.Reader) (mat.Matrix, error) {
+	if err := matrix.parse(rd, false); err != nil {
+		return nil, err
+	}
+	return matrix.mat, nil
+}
+
+// ParseComplex parses a matrix of `TypeComplex` from a `Reader`, similar to
+// `Parse`, and returns the `mat.CMatrix` interface. The interface either holds
+// a `*ComplexCSR` for `FormatCoordinate` or a `*mat.CDense` for `FormatArray`.
+func (matrix *Matrix) ParseComplex(rd io.Reader) (mat.CMatrix, error) {
+	if err := matrix.parse(rd, true); err != nil {
+		return nil, err
+	}
+	return matrix.cmat, nil
+}
+
+// parse performs all parsing steps. The header's value type is verified to
+// match whether a complex matrix is requested.
+func (matrix *Matrix) parse(rd io.Reader, complex bool) error {
 	buf := bufio.NewReader(rd)
 
 	if err := matrix.ParseHeader(buf); err != nil {
-		return nil, err
+		return err
+	}
+	if err := matrix.checkComplex(complex); err != nil {
+		return matrix.parseError(SectionHeader, "", err)
 	}
+	return matrix.parseBody(buf)
+}
 
+// checkComplex validates the value type of the header against the method
+// used for parsing, as matrices of `TypeComplex` require `ParseComplex`.
+func (matrix *Matrix) checkComplex(complex bool) error {
+	if complex && matrix.Type != TypeComplex {
+		return fmt.Errorf("%w: expected %#v, got %#v", ErrUnsupportedType, TypeComplex, matrix.Type)
+	}
+	if !complex && matrix.Type == TypeComplex {
+		return fmt.Errorf("%w: %#v requires ParseComplex", ErrUnsupportedType, TypeComplex)
+	}
+	return nil
+}
+
+// parseBody performs the parsing steps following the header.
+func (matrix *Matrix) parseBody(buf *bufio.Reader) error {
 	if err := matrix.ParseComment(buf); err != nil {
-		return nil, err
+		return err
 	}
 
 	if err := matrix.ParseDimensions(buf); err != nil {
-		return nil, err
+		return err
 	}
 
 	// it is expected to exhaust the reader till EOF
 	err := matrix.ParseMatrix(buf)
 	if err != nil {
 		if err != io.EOF {
-			return nil, err
+			return err
 		}
 	}
-	return matrix.mat, nil
+	return nil
 }
 
-// SaveToMatrixMarket writes a `mat.Matrix` interface towards the `MatrixMarket`
-// format. Currently, all matrices are written as `coordinate real general`
-// types.
-//
-// TODO: support (skew)symmetric outputs
-// TODO: support dense matrix outputs
-func SaveToMatrixMarket(matrix mat.Matrix, wr io.Writer) error {
-	// bufferend output
-	buf := bufio.NewWriter(wr)
+// WriteOption configures how `SaveToMatrixMarket` writes a matrix.
+type WriteOption func(*writeConfig)
 
-	// sparse variant
-	csr, ok := matrix.(*sparse.CSR)
-	if ok {
-		// MatrixMarket header
-		header := fmt.Sprintf("%%%%MatrixMarket matrix %s %s %s\n", FormatCoordinate, TypeReal, General)
-		if _, err := buf.WriteString(header); err != nil {
-			return err
+// writeConfig holds the settings applied by the `WriteOption`s.
+type writeConfig struct {
+	typ      string
+	symmetry string
+	format   string
+	detect   bool
+}
+
+// WithType sets the value type that is written to the header and determines
+// the formatting of the values. Supported are `TypeReal` (default),
+// `TypeInteger`, and `TypePattern`. For `TypeInteger` all values are required
+// to be integral and are written without decimal point. For `TypePattern` only
+// the indices of the stored entries are written, this is only supported for
+// sparse matrices.
+func WithType(typ string) WriteOption {
+	return func(cfg *writeConfig) {
+		cfg.typ = typ
+	}
+}
+
+// WithSymmetry sets the symmetry that is written to the header. For
+// `Symmetric` and `SkewSymmetric` only the lower-triangular part is written,
+// excluding the diagonal for `SkewSymmetric`. The matrix is verified to have
+// the requested symmetry. By default, `*mat.SymDense` matrices are written as
+// `Symmetric` and all others as `General`.
+func WithSymmetry(symmetry string) WriteOption {
+	return func(cfg *writeConfig) {
+		cfg.symmetry = symmetry
+		cfg.detect = false
+	}
+}
+
+// WithDetectSymmetry inspects the values of the matrix and writes it in the
+// most compact form: `Symmetric` or `SkewSymmetric` when the values allow so,
+// otherwise `General`.
+func WithDetectSymmetry() WriteOption {
+	return func(cfg *writeConfig) {
+		cfg.detect = true
+	}
+}
+
+// formatValue formats a single value according to the value type.
+func formatValue(v float64, typ string) (string, error) {
+	if typ == TypeInteger {
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt64 {
+			return "", fmt.Errorf("Value %v is not an integer", v)
 		}
+		return strconv.FormatInt(int64(v), 10), nil
+	}
+	return fmt.Sprintf("%v", v), nil
+}
 
-		// Matrix dimensions and number of lines of output
-		n, m := csr.Dims()
-		nnz := csr.NNZ()
-		if _, err := buf.WriteString(fmt.Sprintf("%d %d %d\n", n, m, nnz)); err != nil {
-			return err
+// WithFormat sets the format the matrix is written in. By default, sparse
+// matrices are written in `FormatCoordinate` and all other matrices in
+// `FormatArray`. Any matrix can be written in either format: for
+// `FormatCoordinate` the non-zero values of dense matrices are written, for
+// `FormatArray` all values of sparse matrices are written.
+func WithFormat(format string) WriteOption {
+	return func(cfg *writeConfig) {
+		cfg.format = format
+	}
+}
+
+// nonZeroDoer is implemented by the sparse matrices that can iterate over
+// their stored entries.
+type nonZeroDoer interface {
+	DoNonZero(func(i, j int, v float64))
+}
+
+// sparseMatrix is a matrix that iterates over its stored entries.
+type sparseMatrix interface {
+	mat.Matrix
+	nonZeroDoer
+}
+
+// nnzer is implemented by the matrices of the `sparse` package. It separates
+// these from the structured `mat` types, e.g. `*mat.TriDense`, that provide
+// `DoNonZero` as well.
+type nnzer interface {
+	NNZ() int
+}
+
+// csrConverter is implemented by the sparse matrices that can be converted to
+// CSR, e.g. `*sparse.COO`, `*sparse.CSC`, and `*sparse.DOK`.
+type csrConverter interface {
+	ToCSR() *sparse.CSR
+}
+
+// transposedSparse is the transpose of a sparse matrix that still provides
+// the iteration over its stored entries.
+type transposedSparse struct {
+	matrix sparseMatrix
+}
+
+// Dims returns the dimensions of the transposed matrix.
+func (t transposedSparse) Dims() (int, int) {
+	n, m := t.matrix.Dims()
+	return m, n
+}
+
+// At returns the value at `(i, j)` of the transposed matrix.
+func (t transposedSparse) At(i, j int) float64 {
+	return t.matrix.At(j, i)
+}
+
+// T returns the original, non-transposed matrix.
+func (t transposedSparse) T() mat.Matrix {
+	return t.matrix
+}
+
+// DoNonZero calls `fn` for each stored entry of the transposed matrix.
+func (t transposedSparse) DoNonZero(fn func(i, j int, v float64)) {
+	t.matrix.DoNonZero(func(i, j int, v float64) {
+		fn(j, i, v)
+	})
+}
+
+// denseNonZeros provides the iteration over the non-zero values of any matrix
+// by inspecting all of its values.
+type denseNonZeros struct {
+	mat.Matrix
+}
+
+// DoNonZero calls `fn` for each non-zero value, in row-major order.
+func (d denseNonZeros) DoNonZero(fn func(i, j int, v float64)) {
+	n, m := d.Dims()
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			if v := d.At(i, j); v != 0 {
+				fn(i, j, v)
+			}
 		}
+	}
+}
 
-		// Apply write function to each non-zero
-		writeNonZero := func(i, j int, v float64) {
-			// Correct for one-base
-			_, err := buf.WriteString(fmt.Sprintf("%d %d %v\n", i+1, j+1, v))
-			if err != nil {
-				fmt.Printf("Error in writing non-zero: %v", err)
+// nonZeros returns the sparse representation of the matrix, if available.
+// Matrices with a CSR conversion are converted first, which yields row-major
+// ordering and sums duplicate entries, e.g. of `*sparse.COO`. Transposed views
+// of sparse matrices remain sparse.
+func nonZeros(matrix mat.Matrix) (sparseMatrix, bool) {
+	if c, ok := matrix.(csrConverter); ok {
+		return c.ToCSR(), true
+	}
+	if s, ok := matrix.(sparseMatrix); ok {
+		if _, ok := matrix.(nnzer); ok {
+			return s, true
+		}
+	}
+	if u, ok := matrix.(mat.Untransposer); ok {
+		if s, ok := nonZeros(u.Untranspose()); ok {
+			return transposedSparse{s}, true
+		}
+	}
+	return nil, false
+}
+
+// hasSymmetry verifies whether the values of the matrix satisfy the given
+// symmetry. For sparse matrices only the stored entries are considered.
+func hasSymmetry(matrix mat.Matrix, symmetry string) bool {
+	n, m := matrix.Dims()
+	switch symmetry {
+	case General:
+		return true
+	case Symmetric, SkewSymmetric:
+		if n != m {
+			return false
+		}
+	default:
+		return false
+	}
+
+	sign := 1.0
+	if symmetry == SkewSymmetric {
+		sign = -1.0
+	}
+
+	if nz, ok := matrix.(nonZeroDoer); ok {
+		valid := true
+		nz.DoNonZero(func(i, j int, v float64) {
+			if valid && matrix.At(j, i) != sign*v {
+				valid = false
+			}
+		})
+		return valid
+	}
+
+	for j := 0; j < m; j++ {
+		for i := j; i < n; i++ {
+			if matrix.At(j, i) != sign*matrix.At(i, j) {
+				return false
 			}
 		}
-		csr.DoNonZero(writeNonZero)
+	}
+	return true
+}
 
-		return buf.Flush()
+// detectSymmetry returns the most compact symmetry the matrix satisfies.
+func detectSymmetry(matrix mat.Matrix) string {
+	for _, symmetry := range []string{Symmetric, SkewSymmetric} {
+		if hasSymmetry(matrix, symmetry) {
+			return symmetry
+		}
 	}
+	return General
+}
 
-	// dense variant
-	dense, ok := matrix.(*mat.Dense)
-	if ok {
-		header := fmt.Sprintf("%%%%MatrixMarket matrix %s %s %s\n", FormatArray, TypeReal, General)
-		_, err := buf.WriteString(header)
-		if err != nil {
-			return err
+// isStored returns whether the entry at `(i, j)` is written for the given
+// symmetry: all entries for `General`, only the lower-triangular part for the
+// others.
+func isStored(i, j int, symmetry string) bool {
+	switch symmetry {
+	case Symmetric:
+		return i >= j
+	case SkewSymmetric:
+		return i > j
+	default:
+		return true
+	}
+}
+
+// SaveToMatrixMarket writes a `mat.Matrix` interface towards the `MatrixMarket`
+// format. Sparse matrices, i.e. those of the `sparse` package that iterate over
+// their non-zeroes, are written in `FormatCoordinate`. All other matrices, e.g.
+// `*mat.Dense`, `*mat.TriDense`, `*mat.VecDense`, or transposed views, are
+// written in `FormatArray` by evaluating each of their values. The format can
+// be changed with `WithFormat`. The value type defaults to `TypeReal` and can
+// be changed with `WithType`. The symmetry can be set with `WithSymmetry` or
+// detected with `WithDetectSymmetry`.
+func SaveToMatrixMarket(matrix mat.Matrix, wr io.Writer, opts ...WriteOption) error {
+	cfg := writeConfig{typ: TypeReal, symmetry: General}
+	if _, ok := matrix.(*mat.SymDense); ok {
+		cfg.symmetry = Symmetric
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	switch cfg.typ {
+	case TypeReal, TypeInteger, TypePattern:
+	default:
+		return fmt.Errorf("Unsupported type for writing: %v", cfg.typ)
+	}
+
+	// select the representation that is written
+	sp, isSparse := nonZeros(matrix)
+	if isSparse {
+		matrix = sp
+	}
+	switch cfg.format {
+	case "":
+		cfg.format = FormatArray
+		if isSparse {
+			cfg.format = FormatCoordinate
 		}
+	case FormatCoordinate:
+		if !isSparse {
+			sp = denseNonZeros{matrix}
+			matrix = sp
+		}
+	case FormatArray:
+	default:
+		return fmt.Errorf("Unsupported format for writing: %v", cfg.format)
+	}
 
-		// Matrix dimensions and number of lines of output
-		n, m := dense.Dims()
-		_, err = buf.WriteString(fmt.Sprintf("%d %d\n", n, m))
-		if err != nil {
-			return err
+	if cfg.detect {
+		cfg.symmetry = detectSymmetry(matrix)
+	} else if !hasSymmetry(matrix, cfg.symmetry) {
+		return fmt.Errorf("Matrix does not satisfy symmetry %#v", cfg.symmetry)
+	}
+	if cfg.typ == TypePattern && cfg.symmetry == SkewSymmetric {
+		return fmt.Errorf("Type %#v does not support symmetry %#v", TypePattern, SkewSymmetric)
+	}
+
+	// bufferend output
+	buf := bufio.NewWriter(wr)
+
+	if cfg.format == FormatCoordinate {
+		return writeCoordinate(buf, sp, cfg)
+	}
+	return writeArray(buf, matrix, cfg)
+}
+
+// Save writes the parsed matrix, or vector, to the `MatrixMarket` format, see
+// `SaveToMatrixMarket`. The value type, symmetry, and format default to those
+// of the parsed file, such that e.g. matrices of `TypeInteger` and
+// `TypePattern` are written as such. The options override these defaults.
+// Matrices of `TypeComplex` are not supported.
+func (matrix *Matrix) Save(wr io.Writer, opts ...WriteOption) error {
+	if matrix.Type == TypeComplex {
+		return fmt.Errorf("Unsupported type for writing: %v", matrix.Type)
+	}
+	if matrix.mat == nil {
+		return fmt.Errorf("No matrix to write, the matrix is not parsed")
+	}
+
+	defaults := []WriteOption{WithType(matrix.Type), WithFormat(matrix.Format)}
+	if vec, ok := matrix.mat.(mat.Vector); ok && matrix.Object == ObjectVector {
+		return SaveVectorToMatrixMarket(vec, wr, append(defaults, opts...)...)
+	}
+
+	// real hermitian matrices are symmetric
+	symmetry := matrix.Symmetry
+	if symmetry == Hermitian {
+		symmetry = Symmetric
+	}
+	defaults = append(defaults, WithSymmetry(symmetry))
+	return SaveToMatrixMarket(matrix.mat, wr, append(defaults, opts...)...)
+}
+
+// writeCoordinate writes the stored entries of a sparse matrix in
+// `FormatCoordinate`.
+func writeCoordinate(buf *bufio.Writer, matrix sparseMatrix, cfg writeConfig) error {
+	// verify all values can be represented before writing any output, and
+	// count the number of entries that are written
+	var invalid error
+	lines := 0
+	matrix.DoNonZero(func(i, j int, v float64) {
+		if !isStored(i, j, cfg.symmetry) {
+			return
+		}
+		lines++
+		if _, err := formatValue(v, cfg.typ); err != nil && invalid == nil {
+			invalid = fmt.Errorf("Entry (%d, %d): %w", i+1, j+1, err)
 		}
+	})
+	if invalid != nil {
+		return invalid
+	}
 
-		for c := 0; c < m; c++ {
-			for r := 0; r < n; r++ {
-				_, err = buf.WriteString(fmt.Sprintf("%v\n", dense.At(r, c)))
-				if err != nil {
-					return err
-				}
-			}
+	// MatrixMarket header
+	header := fmt.Sprintf("%%%%MatrixMarket matrix %s %s %s\n", FormatCoordinate, cfg.typ, cfg.symmetry)
+	if _, err := buf.WriteString(header); err != nil {
+		return err
+	}
+
+	// Matrix dimensions and number of lines of output
+	n, m := matrix.Dims()
+	if _, err := buf.WriteString(fmt.Sprintf("%d %d %d\n", n, m, lines)); err != nil {
+		return err
+	}
+
+	// Apply write function to each non-zero. The iteration cannot be
+	// interrupted, thus after the first failure all remaining entries are
+	// skipped and the error is returned.
+	var err error
+	writeNonZero := func(i, j int, v float64) {
+		if err != nil || !isStored(i, j, cfg.symmetry) {
+			return
+		}
+
+		// Correct for one-base; values are verified above
+		line := fmt.Sprintf("%d %d\n", i+1, j+1)
+		if cfg.typ != TypePattern {
+			s, _ := formatValue(v, cfg.typ)
+			line = fmt.Sprintf("%d %d %s\n", i+1, j+1, s)
+		}
+		if _, werr := buf.WriteString(line); werr != nil {
+			err = fmt.Errorf("Error in writing entry (%d, %d): %w", i+1, j+1, werr)
 		}
-		return buf.Flush()
+	}
+	matrix.DoNonZero(writeNonZero)
+	if err != nil {
+		return err
 	}
 
-	// support dense variant later
-	return fmt.Errorf("No output support yet for dense matrices.")
+	return buf.Flush()
+}
+
+// writeArray writes all values of the matrix in `FormatArray`.
+func writeArray(buf *bufio.Writer, matrix mat.Matrix, cfg writeConfig) error {
+	if cfg.typ == TypePattern {
+		return fmt.Errorf("Type %#v is not supported for format %#v", TypePattern, FormatArray)
+	}
+
+	header := fmt.Sprintf("%%%%MatrixMarket matrix %s %s %s\n", FormatArray, cfg.typ, cfg.symmetry)
+	_, err := buf.WriteString(header)
+	if err != nil {
+		return err
+	}
+
+	// Matrix dimensions and number of lines of output
+	n, m := matrix.Dims()
+	_, err = buf.WriteString(fmt.Sprintf("%d %d\n", n, m))
+	if err != nil {
+		return err
+	}
+
+	// column-major, only the lower-triangular part for symmetric types
+	doArrayEntry(n, m, cfg.symmetry, func(k, r, c int) {
+		if err != nil {
+			return
+		}
+		var s string
+		s, err = formatValue(matrix.At(r, c), cfg.typ)
+		if err != nil {
+			err = fmt.Errorf("Entry (%d, %d): %w", r+1, c+1, err)
+			return
+		}
+		_, err = buf.WriteString(s + "\n")
+	})
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
 }
@@ -1,11 +1,15 @@
-package main
+package gomm
 
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -87,6 +91,91 @@ func TestParsMatrixMarketArrayFormat(t *testing.T) {
 
 }
 
+func TestParseMatrixMarketArraySymmetric(t *testing.T) {
+	sym := []byte(`%%MatrixMarket matrix array real symmetric
+3 3
+1.0
+2.0
+3.0
+4.0
+5.0
+6.0`)
+
+	ref := mat.NewDense(3, 3, []float64{
+		1, 2, 3,
+		2, 4, 5,
+		3, 5, 6,
+	})
+
+	matrix := &Matrix{}
+	smat, err := matrix.Parse(bytes.NewBuffer(sym))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+	if matrix.lines != 6 {
+		t.Errorf("Wrong number of lines parsed: %d, exp: %d", matrix.lines, 6)
+	}
+	if _, ok := smat.(*mat.SymDense); !ok {
+		t.Errorf("Failed conversion matrix interface to expected type %T, from %T", &mat.SymDense{}, smat)
+	}
+	if !mat.Equal(ref, smat) {
+		t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(ref), mat.Formatted(smat))
+	}
+
+	skew := []byte(`%%MatrixMarket matrix array real skew-symmetric
+3 3
+1.0
+2.0
+3.0`)
+
+	ref = mat.NewDense(3, 3, []float64{
+		0, -1, -2,
+		1, 0, -3,
+		2, 3, 0,
+	})
+
+	matrix = &Matrix{}
+	smat, err = matrix.Parse(bytes.NewBuffer(skew))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+	if _, ok := smat.(*mat.Dense); !ok {
+		t.Errorf("Failed conversion matrix interface to expected type %T, from %T", &mat.Dense{}, smat)
+	}
+	if !mat.Equal(ref, smat) {
+		t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(ref), mat.Formatted(smat))
+	}
+
+	herm := []byte(`%%MatrixMarket matrix array complex hermitian
+2 2
+1.0 0.0
+2.0 3.0
+4.0 0.0`)
+
+	cref := mat.NewCDense(2, 2, []complex128{1, 2 - 3i, 2 + 3i, 4})
+
+	matrix = &Matrix{}
+	cmat, err := matrix.ParseComplex(bytes.NewBuffer(herm))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+	if !mat.CEqual(cref, cmat) {
+		t.Errorf("Wrong content: exp %v, got %v", cref, cmat)
+	}
+
+	// faulty inputs: non-square, too few, and too many entries
+	faulty := []string{
+		"%%MatrixMarket matrix array real symmetric\n2 3\n1\n2\n3\n",
+		"%%MatrixMarket matrix array real symmetric\n2 2\n1\n2\n",
+		"%%MatrixMarket matrix array real skew-symmetric\n2 2\n1\n2\n",
+	}
+	for _, f := range faulty {
+		if _, err := (&Matrix{}).Parse(strings.NewReader(f)); err == nil {
+			t.Errorf("Expected error when parsing %q", f)
+		}
+	}
+}
+
 func TestParseMatrixMarketCoordinate(t *testing.T) {
 
 	/*
@@ -149,6 +238,820 @@ func TestParseMatrixMarketCoordinate(t *testing.T) {
 	}
 }
 
+func TestParseMatrixMarketComplex(t *testing.T) {
+	mm := []byte(`%%MatrixMarket matrix coordinate complex hermitian
+3 3 4
+1 1 2.0 0.0
+2 1 1.0 -1.0
+3 2 0.5 2.5
+3 3 4.0 0.0`)
+
+	ref := mat.NewCDense(3, 3, []complex128{
+		2, 1 + 1i, 0,
+		1 - 1i, 0, 0.5 - 2.5i,
+		0, 0.5 + 2.5i, 4,
+	})
+
+	matrix := &Matrix{}
+	cmat, err := matrix.ParseComplex(bytes.NewBuffer(mm))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+
+	csr, ok := cmat.(*ComplexCSR)
+	if !ok {
+		t.Fatalf("Failed conversion matrix interface to expected type %T, from %T", csr, cmat)
+	}
+	if csr.NNZ() != 6 {
+		t.Errorf("Wrong number of non-zero entries: exp %v, got %v", 6, csr.NNZ())
+	}
+	if !mat.CEqual(ref, cmat) {
+		t.Errorf("Wrong content: exp %v, got %v", ref, cmat)
+	}
+	if !mat.CEqual(cmat, cmat.H()) {
+		t.Errorf("Hermitian matrix differs from its conjugate transpose")
+	}
+
+	// complex matrices do not satisfy `mat.Matrix`
+	if _, err := (&Matrix{}).Parse(bytes.NewBuffer(mm)); err == nil {
+		t.Errorf("Expected error when parsing complex matrix with Parse")
+	}
+
+	arr := []byte(`%%MatrixMarket matrix array complex general
+2 2
+1.0 1.0
+2.0 -2.0
+3.0 0.0
+4.0 4.5`)
+
+	ref = mat.NewCDense(2, 2, []complex128{1 + 1i, 3, 2 - 2i, 4 + 4.5i})
+
+	matrix = &Matrix{}
+	cmat, err = matrix.ParseComplex(bytes.NewBuffer(arr))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+	if _, ok := cmat.(*mat.CDense); !ok {
+		t.Errorf("Failed conversion matrix interface to expected type %T, from %T", &mat.CDense{}, cmat)
+	}
+	if !mat.CEqual(ref, cmat) {
+		t.Errorf("Wrong content: exp %v, got %v", ref, cmat)
+	}
+}
+
+func TestParseMatrixMarketInteger(t *testing.T) {
+	mm := []byte(`%%MatrixMarket matrix coordinate integer symmetric
+3 3 3
+1 1 2
+3 1 -7
+3 3 12
+`)
+
+	ref := mat.NewDense(3, 3, []float64{
+		2, 0, -7,
+		0, 0, 0,
+		-7, 0, 12,
+	})
+
+	matrix := &Matrix{}
+	smat, err := matrix.Parse(bytes.NewBuffer(mm))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+	if matrix.Type != TypeInteger {
+		t.Errorf("Wrong type: exp %#v, got %#v", TypeInteger, matrix.Type)
+	}
+	if !mat.Equal(ref, smat) {
+		t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(ref), mat.Formatted(smat))
+	}
+
+	// write back as integer and compare with the expanded general matrix
+	var out bytes.Buffer
+	if err := SaveToMatrixMarket(smat, &out, WithType(TypeInteger)); err != nil {
+		t.Fatal(err)
+	}
+	exp := `%%MatrixMarket matrix coordinate integer general
+3 3 4
+1 1 2
+1 3 -7
+3 1 -7
+3 3 12
+`
+	if out.String() != exp {
+		t.Errorf("Wrong output: exp %q, got %q", exp, out.String())
+	}
+
+	// non-integer values are rejected, both in parsing and writing
+	faulty := []string{
+		"%%MatrixMarket matrix coordinate integer general\n2 2 1\n1 1 1.5\n",
+		"%%MatrixMarket matrix array integer general\n1 1\n1.0\n",
+	}
+	for _, f := range faulty {
+		if _, err := (&Matrix{}).Parse(strings.NewReader(f)); err == nil {
+			t.Errorf("Expected error when parsing non-integer values: %q", f)
+		}
+	}
+
+	dense := mat.NewDense(1, 2, []float64{1, 2.5})
+	if err := SaveToMatrixMarket(dense, &out, WithType(TypeInteger)); err == nil {
+		t.Errorf("Expected error when writing non-integer values as integer")
+	}
+}
+
+func TestParseMatrixMarketPattern(t *testing.T) {
+	mm := []byte(`%%MatrixMarket matrix coordinate pattern symmetric
+4 4 4
+1 1
+3 1
+4 2
+4 4
+`)
+
+	ref := mat.NewDense(4, 4, []float64{
+		1, 0, 1, 0,
+		0, 0, 0, 1,
+		1, 0, 0, 0,
+		0, 1, 0, 1,
+	})
+
+	matrix := &Matrix{}
+	smat, err := matrix.Parse(bytes.NewBuffer(mm))
+	if err != nil {
+		t.Fatalf("Error in parsing matrix: %v", err)
+	}
+	if matrix.Type != TypePattern {
+		t.Errorf("Wrong type: exp %#v, got %#v", TypePattern, matrix.Type)
+	}
+	if !mat.Equal(ref, smat) {
+		t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(ref), mat.Formatted(smat))
+	}
+
+	// round trip keeps only the structure
+	var out bytes.Buffer
+	if err := SaveToMatrixMarket(smat, &out, WithType(TypePattern)); err != nil {
+		t.Fatal(err)
+	}
+	exp := `%%MatrixMarket matrix coordinate pattern general
+4 4 6
+1 1
+1 3
+2 4
+3 1
+4 2
+4 4
+`
+	if out.String() != exp {
+		t.Errorf("Wrong output: exp %q, got %q", exp, out.String())
+	}
+
+	again, err := (&Matrix{}).Parse(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mat.Equal(ref, again) {
+		t.Errorf("Wrong content after round trip: %v", mat.Formatted(again))
+	}
+
+	// pattern entries hold exactly two values
+	faulty := "%%MatrixMarket matrix coordinate pattern general\n2 2 1\n1 1 1.0\n"
+	if _, err := (&Matrix{}).Parse(strings.NewReader(faulty)); err == nil {
+		t.Errorf("Expected error when parsing pattern entry with value")
+	}
+}
+
+func TestParseMatrixMarketCoordinateValidation(t *testing.T) {
+	entries := []struct {
+		str string
+		nnz int // number of non-zeroes in lenient mode
+	}{
+		{ // too few entries
+			str: "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 2 2.0\n",
+			nnz: 2,
+		},
+		{ // too many entries
+			str: "%%MatrixMarket matrix coordinate real general\n3 3 1\n1 1 1.0\n2 2 2.0\n",
+			nnz: 2,
+		},
+		{ // row index out of range
+			str: "%%MatrixMarket matrix coordinate real general\n3 3 2\n1 1 1.0\n4 2 2.0\n",
+			nnz: 1,
+		},
+		{ // column index out of range
+			str: "%%MatrixMarket matrix coordinate real general\n3 3 2\n1 1 1.0\n2 4 2.0\n",
+			nnz: 1,
+		},
+		{ // negative index
+			str: "%%MatrixMarket matrix coordinate real general\n3 3 2\n1 1 1.0\n-1 2 2.0\n",
+			nnz: 1,
+		},
+		{ // zero-based index
+			str: "%%MatrixMarket matrix coordinate real general\n3 3 2\n0 0 1.0\n2 2 2.0\n",
+			nnz: 1,
+		},
+		{ // complex out of range
+			str: "%%MatrixMarket matrix coordinate complex general\n3 3 2\n1 1 1.0 1.0\n2 4 2.0 2.0\n",
+			nnz: 1,
+		},
+	}
+
+	for _, e := range entries {
+		complex := strings.Contains(e.str, TypeComplex)
+
+		matrix := &Matrix{}
+		if err := matrix.parse(strings.NewReader(e.str), complex); err == nil {
+			t.Errorf("Expected error when parsing %q", e.str)
+		}
+
+		matrix = &Matrix{Options: ParseOptions{Lenient: true}}
+		if err := matrix.parse(strings.NewReader(e.str), complex); err != nil {
+			t.Errorf("Expected lenient parsing to succeed for %q, got: %v", e.str, err)
+			continue
+		}
+
+		var nnz int
+		switch mm := matrix.mat.(type) {
+		case *sparse.CSR:
+			nnz = mm.NNZ()
+		default:
+			nnz = matrix.cmat.(*ComplexCSR).NNZ()
+		}
+		if nnz != e.nnz {
+			t.Errorf("Wrong number of non-zero entries for %q: exp %d, got %d", e.str, e.nnz, nnz)
+		}
+	}
+	// matrices with a symmetry should be square, also in lenient mode
+	sizes := []string{
+		"%%MatrixMarket matrix coordinate real symmetric\n2 3 1\n1 3 1.0\n",
+		"%%MatrixMarket matrix coordinate real skew-symmetric\n3 2 1\n3 1 1.0\n",
+		"%%MatrixMarket matrix coordinate pattern symmetric\n2 3 1\n1 3\n",
+		"%%MatrixMarket matrix coordinate complex hermitian\n2 3 1\n1 3 1.0 1.0\n",
+		"%%MatrixMarket matrix coordinate complex symmetric\n3 2 1\n3 1 1.0 1.0\n",
+	}
+	for _, str := range sizes {
+		complex := strings.Contains(str, TypeComplex)
+		for _, options := range []ParseOptions{{}, {Lenient: true}, {Parallel: true}} {
+			err := (&Matrix{Options: options}).parse(strings.NewReader(str), complex)
+			if !errors.Is(err, ErrInvalidSize) {
+				t.Errorf("Expected error %v for %q with %+v, got: %v", ErrInvalidSize, str, options, err)
+			}
+		}
+
+		_, err := NewReader(strings.NewReader(str), ParseOptions{})
+		if !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("Expected error %v from reader for %q, got: %v", ErrInvalidSize, str, err)
+		}
+	}
+}
+
+func TestParseMatrixMarketErrors(t *testing.T) {
+	entries := []struct {
+		str     string
+		line    int
+		section string
+		text    string
+		err     error
+	}{
+		{
+			str:     "",
+			line:    1,
+			section: SectionHeader,
+			err:     ErrUnexpectedEOF,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real unknown\n",
+			line:    1,
+			section: SectionHeader,
+			text:    "%%MatrixMarket matrix coordinate real unknown",
+			err:     ErrUnsupportedSymmetry,
+		},
+		{
+			str:     "%%MatrixMarket matrix sparse real general\n",
+			line:    1,
+			section: SectionHeader,
+			text:    "%%MatrixMarket matrix sparse real general",
+			err:     ErrUnsupportedFormat,
+		},
+		{
+			str:     "%%MatrixMarket vec coordinate real general\n",
+			line:    1,
+			section: SectionHeader,
+			text:    "%%MatrixMarket vec coordinate real general",
+			err:     ErrUnsupportedObject,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n% comment\n%\n",
+			line:    4,
+			section: SectionSize,
+			err:     ErrUnexpectedEOF,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n% comment\n3 3\n",
+			line:    3,
+			section: SectionSize,
+			text:    "3 3",
+			err:     ErrInvalidSize,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n-1 -1 0\n1 1 1.0\n",
+			line:    2,
+			section: SectionSize,
+			text:    "-1 -1 0",
+			err:     ErrInvalidSize,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 -1\n1 1 1.0\n",
+			line:    2,
+			section: SectionSize,
+			text:    "3 3 -1",
+			err:     ErrInvalidSize,
+		},
+		{
+			// the storage allocated up front is limited
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 99999999999\n1 1 1.0\n",
+			line:    3,
+			section: SectionData,
+			err:     ErrUnexpectedEOF,
+		},
+		{
+			str:     "%%MatrixMarket matrix array real general\n-2 2\n1 1 1.0\n",
+			line:    2,
+			section: SectionSize,
+			text:    "-2 2",
+			err:     ErrInvalidSize,
+		},
+		{
+			str:     "%%MatrixMarket matrix array real general\n0 3\n1 1 1.0\n",
+			line:    2,
+			section: SectionSize,
+			text:    "0 3",
+			err:     ErrInvalidSize,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 2\n",
+			line:    4,
+			section: SectionData,
+			text:    "2 2",
+			err:     ErrInvalidEntry,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 5 1.0\n",
+			line:    4,
+			section: SectionData,
+			text:    "2 5 1.0",
+			err:     ErrIndexOutOfRange,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 1\n1 1 1.0\n2 2 1.0\n",
+			line:    4,
+			section: SectionData,
+			text:    "2 2 1.0",
+			err:     ErrTooManyEntries,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 2 1.0\n",
+			line:    4,
+			section: SectionData,
+			err:     ErrUnexpectedEOF,
+		},
+		{
+			str:     "%%MatrixMarket matrix array real general\n2 1\n1.0\n",
+			line:    3,
+			section: SectionData,
+			err:     ErrUnexpectedEOF,
+		},
+	}
+
+	for _, e := range entries {
+		_, err := (&Matrix{}).Parse(strings.NewReader(e.str))
+		if !errors.Is(err, e.err) {
+			t.Errorf("Expected error %v for %q, got: %v", e.err, e.str, err)
+		}
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Expected %T for %q, got: %T", perr, e.str, err)
+			continue
+		}
+		if perr.Line != e.line {
+			t.Errorf("Wrong line for %q: exp %d, got %d", e.str, e.line, perr.Line)
+		}
+		if perr.Section != e.section {
+			t.Errorf("Wrong section for %q: exp %v, got %v", e.str, e.section, perr.Section)
+		}
+		if perr.Text != e.text {
+			t.Errorf("Wrong text for %q: exp %q, got %q", e.str, e.text, perr.Text)
+		}
+	}
+
+	// the underlying cause of invalid numbers is available
+	str := "%%MatrixMarket matrix coordinate real general\n3 3 1\n1 1 one\n"
+	_, err := (&Matrix{}).Parse(strings.NewReader(str))
+	var nerr *strconv.NumError
+	if !errors.As(err, &nerr) {
+		t.Errorf("Expected %T, got: %v", nerr, err)
+	}
+}
+
+func TestParseMatrixMarketExplicitZeros(t *testing.T) {
+	mm := `%%MatrixMarket matrix coordinate real symmetric
+3 3 4
+1 1 1.0
+2 1 0.0
+2 2 0.0
+3 3 2.0
+`
+
+	entries := []struct {
+		zeros ZeroPolicy
+		nnz   int
+	}{
+		{zeros: DropZeros, nnz: 2},
+		{zeros: KeepZeros, nnz: 5},
+	}
+
+	for _, e := range entries {
+		matrix := &Matrix{Options: ParseOptions{Zeros: e.zeros}}
+		smat, err := matrix.Parse(strings.NewReader(mm))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if matrix.ExplicitZeros() != 2 {
+			t.Errorf("Wrong number of explicit zeros: exp %d, got %d", 2, matrix.ExplicitZeros())
+		}
+		if matrix.NNZ() != e.nnz {
+			t.Errorf("Wrong number of non-zero entries: exp %d, got %d", e.nnz, matrix.NNZ())
+		}
+		if nnz := smat.(*sparse.CSR).NNZ(); nnz != e.nnz {
+			t.Errorf("Wrong number of stored entries: exp %d, got %d", e.nnz, nnz)
+		}
+
+		// kept zeros are part of the structure and are written as well
+		var out bytes.Buffer
+		if err := SaveToMatrixMarket(smat, &out); err != nil {
+			t.Fatal(err)
+		}
+		again := &Matrix{Options: ParseOptions{Zeros: KeepZeros}}
+		if _, err := again.Parse(&out); err != nil {
+			t.Fatal(err)
+		}
+		if again.NNZ() != e.nnz {
+			t.Errorf("Wrong number of non-zero entries after round trip: exp %d, got %d", e.nnz, again.NNZ())
+		}
+	}
+}
+
+func TestParseMatrixMarketDuplicates(t *testing.T) {
+	mm := `%%MatrixMarket matrix coordinate real general
+2 2 5
+1 1 1.0
+2 1 3.0
+1 1 2.0
+2 2 5.0
+1 1 4.0
+`
+
+	entries := []struct {
+		policy DuplicatePolicy
+		v      float64 // value at (0, 0)
+	}{
+		{policy: SumDuplicates, v: 7.0},
+		{policy: KeepFirstDuplicate, v: 1.0},
+		{policy: KeepLastDuplicate, v: 4.0},
+	}
+
+	for _, e := range entries {
+		matrix := &Matrix{Options: ParseOptions{Duplicates: e.policy}}
+		smat, err := matrix.Parse(strings.NewReader(mm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := smat.At(0, 0); v != e.v {
+			t.Errorf("Wrong value for policy %v: exp %v, got %v", e.policy, e.v, v)
+		}
+		if smat.At(1, 0) != 3.0 || smat.At(1, 1) != 5.0 {
+			t.Errorf("Wrong content for policy %v: %v", e.policy, mat.Formatted(smat))
+		}
+		if matrix.Duplicates() != 2 {
+			t.Errorf("Wrong number of duplicates: exp %d, got %d", 2, matrix.Duplicates())
+		}
+		if matrix.NNZ() != 3 {
+			t.Errorf("Wrong number of non-zero entries: exp %d, got %d", 3, matrix.NNZ())
+		}
+	}
+
+	// rejecting duplicates names both lines
+	matrix := &Matrix{Options: ParseOptions{Duplicates: RejectDuplicates}}
+	_, err := matrix.Parse(strings.NewReader(mm))
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("Expected error %v, got: %v", ErrDuplicateEntry, err)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 5 {
+		t.Errorf("Expected error on line 5, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "lines 3 and 5") {
+		t.Errorf("Expected error to refer to both lines, got: %v", err)
+	}
+
+	// complex entries follow the same policy
+	cmm := `%%MatrixMarket matrix coordinate complex general
+1 1 2
+1 1 1.0 1.0
+1 1 2.0 -1.0
+`
+	matrix = &Matrix{Options: ParseOptions{Duplicates: KeepLastDuplicate}}
+	cmat, err := matrix.ParseComplex(strings.NewReader(cmm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := cmat.At(0, 0); v != 2-1i {
+		t.Errorf("Wrong value: exp %v, got %v", 2-1i, v)
+	}
+
+	// the entries may exceed the number of values of the matrix
+	heavy := "%%MatrixMarket matrix coordinate real general\n1 1 3\n1 1 1.0\n1 1 2.0\n1 1 4.0\n"
+	for _, options := range []ParseOptions{{}, {Lenient: true}, {Parallel: true}} {
+		matrix := &Matrix{Options: options}
+		smat, err := matrix.Parse(strings.NewReader(heavy))
+		if err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", options, err)
+		}
+		if v := smat.At(0, 0); v != 7.0 || matrix.Duplicates() != 2 {
+			t.Errorf("Wrong value for %+v: exp %v with %d duplicates, got %v with %d", options, 7.0, 2, v, matrix.Duplicates())
+		}
+	}
+	vec, err := (&Matrix{}).ParseVector(strings.NewReader("%%MatrixMarket vector coordinate real general\n1 2\n1 1.0\n1 2.0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := vec.AtVec(0); v != 3.0 {
+		t.Errorf("Wrong vector value: exp %v, got %v", 3.0, v)
+	}
+}
+
+func TestParseMatrixMarketDuplicatesSymmetric(t *testing.T) {
+	entries := []struct {
+		str    string
+		policy DuplicatePolicy
+		v      complex128 // value at (1, 0)
+	}{
+		{str: "real symmetric\n2 2 2\n2 1 1.0\n1 2 2.0\n", policy: SumDuplicates, v: 3},
+		{str: "real symmetric\n2 2 2\n2 1 1.0\n1 2 2.0\n", policy: KeepFirstDuplicate, v: 1},
+		{str: "real symmetric\n2 2 2\n2 1 1.0\n1 2 2.0\n", policy: KeepLastDuplicate, v: 2},
+		{str: "real skew-symmetric\n2 2 2\n2 1 1.0\n1 2 2.0\n", policy: SumDuplicates, v: -1},
+		{str: "complex hermitian\n2 2 2\n2 1 1.0 1.0\n1 2 2.0 1.0\n", policy: SumDuplicates, v: 3},
+		{str: "complex skew-symmetric\n2 2 2\n2 1 1.0 1.0\n1 2 2.0 1.0\n", policy: KeepLastDuplicate, v: -2 - 1i},
+	}
+
+	for _, e := range entries {
+		str := "%%MatrixMarket matrix coordinate " + e.str
+		matrix := &Matrix{Options: ParseOptions{Duplicates: e.policy}}
+		var v complex128
+		if strings.Contains(e.str, "complex") {
+			cmat, err := matrix.ParseComplex(strings.NewReader(str))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v = cmat.At(1, 0)
+		} else {
+			smat, err := matrix.Parse(strings.NewReader(str))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v = complex(smat.At(1, 0), 0)
+		}
+		if v != e.v {
+			t.Errorf("Wrong value for %q with policy %v: exp %v, got %v", e.str, e.policy, e.v, v)
+		}
+		if matrix.Duplicates() != 1 {
+			t.Errorf("Wrong number of duplicates for %q: exp %d, got %d", e.str, 1, matrix.Duplicates())
+		}
+
+		// mirrored entries are duplicates as well
+		matrix = &Matrix{Options: ParseOptions{Duplicates: RejectDuplicates}}
+		err := matrix.parse(strings.NewReader(str), strings.Contains(e.str, "complex"))
+		if !errors.Is(err, ErrDuplicateEntry) {
+			t.Errorf("Expected error %v for %q, got: %v", ErrDuplicateEntry, e.str, err)
+		}
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	entries := []struct {
+		n    int
+		I, J []int
+		exp  []int
+	}{
+		{n: 3, I: []int{2, 0, 2, 0, 1, 0}, J: []int{1, 2, 0, 2, 1, 0}, exp: []int{5, 1, 3, 4, 2, 0}},
+		{n: 10, I: []int{9, 0, 9, 0}, J: []int{0, 1, 0, 0}, exp: []int{3, 1, 0, 2}},
+		{n: 2, I: []int{}, J: []int{}, exp: []int{}},
+	}
+
+	// sort rows concurrently for any number of entries
+	defer func(size int) { minParallelSort = size }(minParallelSort)
+	minParallelSort = 0
+
+	for _, e := range entries {
+		for _, workers := range []int{1, 2, 4} {
+			perm := sortEntries(e.n, e.I, e.J, workers)
+			if !reflect.DeepEqual(perm, e.exp) {
+				t.Errorf("Wrong order for %v, %v on %d workers: exp %v, got %v", e.I, e.J, workers, e.exp, perm)
+			}
+		}
+	}
+}
+
+func TestParseMatrixMarketWhitespace(t *testing.T) {
+	entries := []struct {
+		str string
+		exp string
+	}{
+		{
+			str: "%%MatrixMarket  matrix\tcoordinate real   general\r\n" +
+				"  % indented comment\r\n" +
+				"\r\n" +
+				" 3\t3  3 \r\n" +
+				"1 1\t1.0\r\n" +
+				"\r\n" +
+				"  2  2  2.0  \r\n" +
+				"\t\n" +
+				"3 3 3.0",
+			exp: "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 2 2.0\n3 3 3.0\n",
+		},
+		{
+			str: "%%MatrixMarket\tmatrix array real general\r\n2  1\r\n\r\n 1.0 \r\n\r\n2.0\r\n",
+			exp: "%%MatrixMarket matrix array real general\n2 1\n1.0\n2.0\n",
+		},
+	}
+
+	for _, e := range entries {
+		ref, err := (&Matrix{}).Parse(strings.NewReader(e.exp))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, parallel := range []bool{false, true} {
+			smat, err := (&Matrix{Options: ParseOptions{Parallel: parallel}}).Parse(strings.NewReader(e.str))
+			if err != nil {
+				t.Fatalf("Unexpected error for %q: %v", e.str, err)
+			}
+			if !mat.Equal(ref, smat) {
+				t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(ref), mat.Formatted(smat))
+			}
+		}
+	}
+
+	// complex entries
+	str := "%%MatrixMarket matrix coordinate complex general\r\n2 2 2\r\n1 1 1.0\t2.0\r\n\r\n2 2  3.0 4.0\r\n"
+	cmat, err := (&Matrix{}).ParseComplex(strings.NewReader(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmat.At(0, 0) != 1+2i || cmat.At(1, 1) != 3+4i {
+		t.Errorf("Wrong content: got %v, %v", cmat.At(0, 0), cmat.At(1, 1))
+	}
+}
+
+func TestParseMatrixMarketLineLength(t *testing.T) {
+	long := strings.Repeat("1", 100)
+	entries := []struct {
+		str     string
+		line    int
+		section string
+	}{
+		{
+			str:     "%%MatrixMarket matrix coordinate real general" + strings.Repeat(" ", 100) + "\n1 1 1\n1 1 1.0\n",
+			line:    1,
+			section: SectionHeader,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n%" + long + "\n1 1 1\n1 1 1.0\n",
+			line:    2,
+			section: SectionComment,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n1 1 " + long + "\n1 1 1.0\n",
+			line:    2,
+			section: SectionSize,
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n1 1 2\n1 1 1.0\n1 1 " + long + "\n",
+			line:    4,
+			section: SectionData,
+		},
+		{
+			str:     "%%MatrixMarket matrix array real general\n2 1\n1.0\n" + long + "\n",
+			line:    4,
+			section: SectionData,
+		},
+	}
+
+	for _, e := range entries {
+		for _, parallel := range []bool{false, true} {
+			options := ParseOptions{MaxLineLength: 64, Parallel: parallel}
+			_, err := (&Matrix{Options: options}).Parse(strings.NewReader(e.str))
+			if !errors.Is(err, ErrLineTooLong) {
+				t.Errorf("Expected error %v for %q, got: %v", ErrLineTooLong, e.str, err)
+				continue
+			}
+
+			var perr *ParseError
+			if !errors.As(err, &perr) || perr.Line != e.line || perr.Section != e.section {
+				t.Errorf("Expected error on line %d (%s), got: %v", e.line, e.section, err)
+			}
+		}
+
+		// the default allows longer lines
+		if _, err := (&Matrix{}).Parse(strings.NewReader(e.str)); errors.Is(err, ErrLineTooLong) {
+			t.Errorf("Unexpected error for %q: %v", e.str, err)
+		}
+	}
+}
+
+func TestParseMatrixMarketFortran(t *testing.T) {
+	str := `%%MatrixMarket matrix coordinate real general
+2 2 2
+1 1 1.0D+03
+2 2 -2.5d-1
+`
+	smat, err := (&Matrix{}).Parse(strings.NewReader(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if smat.At(0, 0) != 1e3 || smat.At(1, 1) != -0.25 {
+		t.Errorf("Wrong content: %v", mat.Formatted(smat))
+	}
+}
+
+func TestParseMatrixMarketNonFinite(t *testing.T) {
+	entries := []struct {
+		str   string
+		lines []int
+	}{
+		{
+			str:   "%%MatrixMarket matrix coordinate real general\n2 2 3\n1 1 1.0\n1 2 nan\n2 2 -Inf\n",
+			lines: []int{4, 5},
+		},
+		{
+			str:   "%%MatrixMarket matrix array real general\n2 1\ninf\n1.0\n",
+			lines: []int{3},
+		},
+		{
+			str:   "%%MatrixMarket matrix coordinate complex general\n2 2 2\n1 1 1.0 0.0\n2 2 0.0 NaN\n",
+			lines: []int{4},
+		},
+		{
+			str:   "%%MatrixMarket matrix array complex general\n2 1\n1.0 0.0\n-inf 0.0\n",
+			lines: []int{4},
+		},
+	}
+
+	for _, e := range entries {
+		complex := strings.Contains(e.str, TypeComplex)
+		parse := func(matrix *Matrix) error {
+			if complex {
+				_, err := matrix.ParseComplex(strings.NewReader(e.str))
+				return err
+			}
+			_, err := matrix.Parse(strings.NewReader(e.str))
+			return err
+		}
+
+		// rejected by default, at the first non-finite value
+		err := parse(&Matrix{})
+		if !errors.Is(err, ErrNonFinite) {
+			t.Errorf("Expected error %v for %q, got: %v", ErrNonFinite, e.str, err)
+			continue
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != e.lines[0] {
+			t.Errorf("Expected error on line %d, got: %v", e.lines[0], err)
+		}
+
+		// allowed values are reported by their lines
+		matrix := &Matrix{Options: ParseOptions{NonFinite: AllowNonFinite}}
+		if err := parse(matrix); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", e.str, err)
+		}
+		if fmt.Sprint(matrix.NonFinite()) != fmt.Sprint(e.lines) {
+			t.Errorf("Wrong lines: exp %v, got %v", e.lines, matrix.NonFinite())
+		}
+	}
+
+	// the streaming reader follows the same policy
+	r, err := NewReader(strings.NewReader(entries[0].str), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, _, _, err = r.Next()
+	}
+	if !errors.Is(err, ErrNonFinite) {
+		t.Errorf("Expected error %v, got: %v", ErrNonFinite, err)
+	}
+}
+
 func TestParseMatrixMarketDimensions(t *testing.T) {
 	entries := []entry{
 		{ // valid
@@ -283,6 +1186,22 @@ func TestParseMatrixMarketHeader(t *testing.T) {
 				Symmetry: General,
 			},
 		},
+		{
+			str: []byte("%%MatrixMarket matrix coordinate complex hermitian"),
+			matrix: Matrix{
+				Format:   FormatCoordinate,
+				Type:     TypeComplex,
+				Symmetry: Hermitian,
+			},
+		},
+		{
+			str: []byte("%%MatrixMarket matrix array integer skew-symmetric"),
+			matrix: Matrix{
+				Format:   FormatArray,
+				Type:     TypeInteger,
+				Symmetry: SkewSymmetric,
+			},
+		},
 		{ // lower case %%MatrixMarket should also pass
 			str: []byte("%%matrixmarket matrix array pattern general"),
 			matrix: Matrix{
@@ -688,3 +1607,254 @@ func TestWriteMatrixMarketFormatDense(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestWriteMatrixMarketSymmetric(t *testing.T) {
+	coo := sparse.NewCOO(3, 3, nil, nil, nil)
+	coo.Set(0, 0, 4.0)
+	coo.Set(1, 0, -1.0)
+	coo.Set(0, 1, -1.0)
+	coo.Set(2, 1, 2.5)
+	coo.Set(1, 2, 2.5)
+	coo.Set(2, 2, 3.0)
+	sym := coo.ToCSR()
+
+	coo = sparse.NewCOO(3, 3, nil, nil, nil)
+	coo.Set(1, 0, 1.0)
+	coo.Set(0, 1, -1.0)
+	coo.Set(2, 0, 2.0)
+	coo.Set(0, 2, -2.0)
+	skew := coo.ToCSR()
+
+	dense := mat.NewSymDense(2, []float64{
+		1, 2,
+		2, 3,
+	})
+
+	entries := []struct {
+		matrix mat.Matrix
+		opts   []WriteOption
+		exp    string
+	}{
+		{
+			matrix: sym,
+			opts:   []WriteOption{WithSymmetry(Symmetric)},
+			exp: `%%MatrixMarket matrix coordinate real symmetric
+3 3 4
+1 1 4
+2 1 -1
+3 2 2.5
+3 3 3
+`,
+		},
+		{
+			matrix: skew,
+			opts:   []WriteOption{WithDetectSymmetry()},
+			exp: `%%MatrixMarket matrix coordinate real skew-symmetric
+3 3 2
+2 1 1
+3 1 2
+`,
+		},
+		{ // `*mat.SymDense` is written symmetric by default
+			matrix: dense,
+			exp: `%%MatrixMarket matrix array real symmetric
+2 2
+1
+2
+3
+`,
+		},
+		{ // unless requested otherwise
+			matrix: dense,
+			opts:   []WriteOption{WithSymmetry(General)},
+			exp: `%%MatrixMarket matrix array real general
+2 2
+1
+2
+2
+3
+`,
+		},
+	}
+
+	for _, e := range entries {
+		var out bytes.Buffer
+		if err := SaveToMatrixMarket(e.matrix, &out, e.opts...); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != e.exp {
+			t.Errorf("Wrong output: exp %q, got %q", e.exp, out.String())
+		}
+
+		// parsing the compact output gives back the original matrix
+		matrix, err := (&Matrix{}).Parse(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !mat.Equal(e.matrix, matrix) {
+			t.Errorf("Wrong content after round trip: %v", mat.Formatted(matrix))
+		}
+	}
+
+	// matrices that do not satisfy the requested symmetry are rejected
+	var out bytes.Buffer
+	if err := SaveToMatrixMarket(skew, &out, WithSymmetry(Symmetric)); err == nil {
+		t.Errorf("Expected error when writing non-symmetric matrix as symmetric")
+	}
+}
+
+func TestWriteMatrixMarketTypes(t *testing.T) {
+	coo := sparse.NewCOO(3, 4, nil, nil, nil)
+	coo.Set(0, 0, 1.0)
+	coo.Set(2, 1, 2.0)
+	coo.Set(1, 3, 3.0)
+	coo.Set(1, 3, 0.5) // duplicate entries are summed
+	ref := coo.ToDense()
+
+	dok := sparse.NewDOK(3, 4)
+	dok.Set(0, 0, 1.0)
+	dok.Set(2, 1, 2.0)
+	dok.Set(1, 3, 3.5)
+
+	tri := mat.NewTriDense(3, mat.Lower, []float64{
+		1, 0, 0,
+		2, 3, 0,
+		4, 5, 6,
+	})
+
+	entries := []struct {
+		matrix mat.Matrix
+		opts   []WriteOption
+		format string
+	}{
+		{matrix: coo, format: FormatCoordinate},
+		{matrix: coo.ToCSC(), format: FormatCoordinate},
+		{matrix: dok, format: FormatCoordinate},
+		{matrix: coo.ToCSR().T(), format: FormatCoordinate},
+		{matrix: mat.Transpose{Matrix: coo}, format: FormatCoordinate},
+		{matrix: sparse.NewDIA(3, 3, []float64{1, 2, 3}), format: FormatCoordinate},
+		{matrix: ref, format: FormatArray},
+		{matrix: ref.T(), format: FormatArray},
+		{matrix: tri, format: FormatArray},
+		{matrix: mat.NewVecDense(3, []float64{1, 0, 3}), format: FormatArray},
+		{matrix: ref, opts: []WriteOption{WithFormat(FormatCoordinate)}, format: FormatCoordinate},
+		{matrix: coo, opts: []WriteOption{WithFormat(FormatArray)}, format: FormatArray},
+	}
+
+	for _, e := range entries {
+		var out bytes.Buffer
+		if err := SaveToMatrixMarket(e.matrix, &out, e.opts...); err != nil {
+			t.Fatalf("Error in writing %T: %v", e.matrix, err)
+		}
+
+		matrix := &Matrix{}
+		mm, err := matrix.Parse(&out)
+		if err != nil {
+			t.Fatalf("Error in parsing written %T: %v", e.matrix, err)
+		}
+		if matrix.Format != e.format {
+			t.Errorf("Wrong format for %T: exp %#v, got %#v", e.matrix, e.format, matrix.Format)
+		}
+		if !mat.Equal(e.matrix, mm) {
+			t.Errorf("Wrong content for %T: exp %v, got %v", e.matrix, mat.Formatted(e.matrix), mat.Formatted(mm))
+		}
+	}
+}
+
+// failingWriter fails all writes after `n` bytes have been written.
+type failingWriter struct {
+	n int
+}
+
+var errWriterFull = errors.New("writer is full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		written := w.n
+		w.n = 0
+		return written, errWriterFull
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestSaveMatrixMarket(t *testing.T) {
+	entries := []struct {
+		str  string
+		opts []WriteOption
+		exp  string
+	}{
+		{
+			str: "%%MatrixMarket matrix coordinate integer general\n2 2 2\n1 1 3\n2 1 -4\n",
+			exp: "%%MatrixMarket matrix coordinate integer general\n2 2 2\n1 1 3\n2 1 -4\n",
+		},
+		{
+			str: "%%MatrixMarket matrix coordinate pattern symmetric\n3 3 3\n1 1\n3 1\n3 2\n",
+			exp: "%%MatrixMarket matrix coordinate pattern symmetric\n3 3 3\n1 1\n3 1\n3 2\n",
+		},
+		{
+			str: "%%MatrixMarket matrix array integer skew-symmetric\n2 2\n5\n",
+			exp: "%%MatrixMarket matrix array integer skew-symmetric\n2 2\n5\n",
+		},
+		{
+			str: "%%MatrixMarket vector coordinate integer general\n3 1\n2 7\n",
+			exp: "%%MatrixMarket vector coordinate integer general\n3 1\n2 7\n",
+		},
+		{
+			str:  "%%MatrixMarket matrix coordinate integer general\n2 2 2\n1 1 3\n2 1 -4\n",
+			opts: []WriteOption{WithType(TypeReal), WithFormat(FormatArray)},
+			exp:  "%%MatrixMarket matrix array real general\n2 2\n3\n-4\n0\n0\n",
+		},
+	}
+
+	for _, e := range entries {
+		matrix := &Matrix{}
+		var err error
+		if strings.Contains(e.str, "vector") {
+			_, err = matrix.ParseVector(strings.NewReader(e.str))
+		} else {
+			_, err = matrix.Parse(strings.NewReader(e.str))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := matrix.Save(&out, e.opts...); err != nil {
+			t.Fatalf("Error in saving %q: %v", e.str, err)
+		}
+		if out.String() != e.exp {
+			t.Errorf("Wrong output: exp %q, got %q", e.exp, out.String())
+		}
+	}
+
+	// complex and unparsed matrices are not written
+	matrix := &Matrix{}
+	if _, err := matrix.ParseComplex(strings.NewReader("%%MatrixMarket matrix array complex general\n1 1\n1 2\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, matrix := range []*Matrix{matrix, {}} {
+		if err := matrix.Save(ioutil.Discard); err == nil {
+			t.Errorf("Expected error for saving %v", matrix)
+		}
+	}
+}
+
+func TestWriteMatrixMarketFailingWriter(t *testing.T) {
+	// enough entries to exceed the internal buffer of the writer
+	n := 5000
+	coo := sparse.NewCOO(n, n, nil, nil, nil)
+	for i := 0; i < n; i++ {
+		coo.Set(i, i, float64(i)+0.5)
+	}
+	dense := mat.NewDense(100, 100, nil)
+
+	for _, matrix := range []mat.Matrix{coo.ToCSR(), dense} {
+		for _, size := range []int{0, 10, 100, 4096, 10000} {
+			err := SaveToMatrixMarket(matrix, &failingWriter{n: size})
+			if !errors.Is(err, errWriterFull) {
+				t.Errorf("Expected error %v for %T after %d bytes, got %v", errWriterFull, matrix, size, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,800 @@
+package gomm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/james-bowman/sparse"
+	"gonum.org/v1/gonum/mat"
+)
+
+// HBHeader holds the header of a matrix in the Harwell-Boeing format. The
+// format stores the matrix in compressed sparse column form, with the column
+// pointers, row indices, and values in fixed-width Fortran formats, optionally
+// followed by right-hand sides, initial guesses and exact solutions.
+type HBHeader struct {
+	Title string
+	Key   string
+
+	// Type is the three letter matrix type code, e.g. `RUA` for a real
+	// unsymmetric assembled matrix, or `PSA` for a symmetric pattern.
+	Type string
+
+	// The number of lines in total, and of the pointers, indices, values
+	// and right-hand sides.
+	TotalLines, PointerLines, IndexLines, ValueLines, RHSLines int
+
+	Rows, Cols, NNZ, Elements int
+
+	// The Fortran formats of the sections, e.g. `(10I8)` or `(4E20.12)`.
+	PointerFormat, IndexFormat, ValueFormat, RHSFormat string
+
+	// RHSType describes the vectors following the matrix: `F` for full or
+	// `M` for sparse right-hand sides, followed by `G` when initial guesses
+	// and `X` when exact solutions are present, e.g. `FGX`. The number of
+	// right-hand sides is given by `RHS`, and their total number of stored
+	// entries by `RHSIndices`, for sparse right-hand sides only.
+	RHSType         string
+	RHS, RHSIndices int
+}
+
+// HarwellBoeing returns the header of a matrix parsed from the Harwell-Boeing
+// format, or nil otherwise.
+func (matrix *Matrix) HarwellBoeing() *HBHeader {
+	return matrix.hb
+}
+
+// RHS returns the right-hand sides of a matrix parsed from the Harwell-Boeing
+// format, if present. Full right-hand sides are returned as `*mat.VecDense`,
+// sparse ones as `*sparse.Vector`.
+func (matrix *Matrix) RHS() []mat.Vector {
+	return matrix.rhs
+}
+
+// Guess returns the initial guesses of a matrix parsed from the
+// Harwell-Boeing format, if present.
+func (matrix *Matrix) Guess() []mat.Vector {
+	return matrix.guess
+}
+
+// Exact returns the exact solutions of a matrix parsed from the
+// Harwell-Boeing format, if present.
+func (matrix *Matrix) Exact() []mat.Vector {
+	return matrix.exact
+}
+
+// ParseHarwellBoeing parses a matrix in the Harwell-Boeing format from a
+// `Reader`, e.g. the `.rua`, `.rsa` or `.psa` files of the `Harwell-Boeing`
+// collection. The matrix is returned as `*sparse.CSR`, identical to parsing
+// the same matrix in `FormatCoordinate` with `Parse`, and the `ParseOptions`
+// apply similarly. The header is available from `HarwellBoeing`, and the
+// optional vectors from `RHS`, `Guess` and `Exact`. Only assembled matrices
+// are supported, and matrices of `TypeComplex` should be parsed with
+// `ParseHarwellBoeingComplex` instead.
+func (matrix *Matrix) ParseHarwellBoeing(rd io.Reader) (mat.Matrix, error) {
+	if err := matrix.parseHarwellBoeing(rd, false); err != nil {
+		return nil, err
+	}
+	return matrix.mat, nil
+}
+
+// ParseHarwellBoeingComplex parses a matrix of `TypeComplex` in the
+// Harwell-Boeing format, similar to `ParseHarwellBoeing`, into a
+// `*ComplexCSR`. The vectors following complex matrices are not parsed.
+func (matrix *Matrix) ParseHarwellBoeingComplex(rd io.Reader) (mat.CMatrix, error) {
+	if err := matrix.parseHarwellBoeing(rd, true); err != nil {
+		return nil, err
+	}
+	return matrix.cmat, nil
+}
+
+// fortranFormatRegexp matches the Fortran formats of the Harwell-Boeing
+// sections: an optional scale factor, the number of fields per line, the
+// edit descriptor, and the width of the fields.
+var fortranFormatRegexp = regexp.MustCompile(`(?i)^\(\s*(?:([+-]?\d+)P\s*,?\s*)?(\d*)\s*(I|ES|EN|E|D|F|G)\s*(\d+)(?:\.(\d+))?(?:E\d+)?\s*\)$`)
+
+// fortranFormat describes a Fortran format, e.g. `(10I8)` or `(1P,4E20.12)`,
+// that holds `count` fields of `width` characters on each line.
+type fortranFormat struct {
+	count, width, precision, scale int
+	kind                           string
+}
+
+// parseFortranFormat parses a Fortran format of a single repeated edit
+// descriptor.
+func parseFortranFormat(s string) (fortranFormat, error) {
+	parts := fortranFormatRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if parts == nil {
+		return fortranFormat{}, fmt.Errorf("%w: unsupported Fortran format %#v", ErrInvalidHeader, s)
+	}
+
+	f := fortranFormat{count: 1, kind: strings.ToUpper(parts[3])}
+	f.scale, _ = strconv.Atoi(parts[1])
+	if parts[2] != "" {
+		f.count, _ = strconv.Atoi(parts[2])
+	}
+	f.width, _ = strconv.Atoi(parts[4])
+	f.precision, _ = strconv.Atoi(parts[5])
+	if f.count < 1 || f.width < 1 {
+		return fortranFormat{}, fmt.Errorf("%w: unsupported Fortran format %#v", ErrInvalidHeader, s)
+	}
+	return f, nil
+}
+
+// parseFortranValue parses a real value of a fixed-width Fortran field.
+// Besides the formats of `parseFloat`, exponents without exponent letter,
+// e.g. `1.5-100`, are accepted, and values without exponent are divided by
+// the scale factor `10^scale` of the format.
+func parseFortranValue(b []byte, scale int) (float64, error) {
+	if bytes.IndexAny(b, "eEdD") >= 0 {
+		return parseFloat(b)
+	}
+
+	// an exponent without letter follows the mantissa as signed integer
+	if k := bytes.LastIndexAny(b, "+-"); k > 0 && len(b) < 64 {
+		var buf [64]byte
+		n := copy(buf[:], b[:k])
+		buf[n] = 'e'
+		n += 1 + copy(buf[n+1:], b[k:])
+		if v, err := parseFloat(buf[:n]); err == nil {
+			return v, nil
+		}
+	}
+
+	v, err := parseFloat(b)
+	if err != nil || scale == 0 {
+		return v, err
+	}
+	return v / math.Pow10(scale), nil
+}
+
+// hbReader reads the lines of a file in the Harwell-Boeing format, with the
+// formats of the pointers, indices, values, and right-hand sides.
+type hbReader struct {
+	matrix  *Matrix
+	scanner *bufio.Scanner
+
+	ptrFmt, indFmt, valFmt, rhsFmt fortranFormat
+}
+
+// next returns the next line of the given section.
+func (r *hbReader) next(section string) ([]byte, error) {
+	if r.scanner.Scan() {
+		r.matrix.line++
+		return r.scanner.Bytes(), nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, r.matrix.scanError(section, err)
+	}
+	r.matrix.line++
+	return nil, r.matrix.parseError(section, "", ErrUnexpectedEOF)
+}
+
+// read reads `n` fixed-width fields of the given format, starting on a new
+// line. The function `fn` is called for each field with its position.
+func (r *hbReader) read(n int, f fortranFormat, fn func(k int, field []byte) error) error {
+	for k := 0; k < n; {
+		line, err := r.next(SectionData)
+		if err != nil {
+			return err
+		}
+
+		for c := 0; c < f.count && k < n; c, k = c+1, k+1 {
+			start, end := c*f.width, (c+1)*f.width
+			if start > len(line) {
+				start = len(line)
+			}
+			if end > len(line) {
+				end = len(line)
+			}
+			if err := fn(k, bytes.TrimSpace(line[start:end])); err != nil {
+				return r.matrix.parseError(SectionData, string(line), err)
+			}
+		}
+	}
+	return nil
+}
+
+// readValues reads `n` real values of the given format, with integer formats
+// holding values of `TypeInteger`. Values are validated against the
+// `NonFinite` policy.
+func (r *hbReader) readValues(n int, f fortranFormat) ([]float64, error) {
+	values := make([]float64, 0, preallocSize(n))
+	err := r.read(n, f, func(k int, field []byte) error {
+		var v float64
+		if f.kind == "I" {
+			i, err := parseInt64(field)
+			if err != nil {
+				return err
+			}
+			v = float64(i)
+		} else {
+			var err error
+			if v, err = parseFortranValue(field, f.scale); err != nil {
+				return err
+			}
+		}
+		values = append(values, v)
+		return r.matrix.checkFinite(complex(v, 0))
+	})
+	return values, err
+}
+
+// readPointers reads `n` one-based pointers into `m` entries, these should
+// start at one, increase, and end at `m+1`.
+func (r *hbReader) readPointers(n, m int, f fortranFormat) ([]int, error) {
+	ptr := make([]int, 0, preallocSize(n))
+	err := r.read(n, f, func(k int, field []byte) error {
+		p, err := parseInt(field)
+		if err != nil {
+			return err
+		}
+		switch {
+		case k == 0 && p != 1:
+			return fmt.Errorf("%w: first pointer is %d, exp 1", ErrInvalidEntry, p)
+		case k > 0 && p < ptr[k-1]:
+			return fmt.Errorf("%w: pointer %d decreases from %d to %d", ErrInvalidEntry, k+1, ptr[k-1], p)
+		case k == n-1 && p != m+1:
+			return fmt.Errorf("%w: last pointer is %d, exp %d", ErrInvalidEntry, p, m+1)
+		}
+		ptr = append(ptr, p)
+		return nil
+	})
+	return ptr, err
+}
+
+// readIndices reads `n` one-based indices, and the lines these are read from.
+func (r *hbReader) readIndices(n int, f fortranFormat) ([]int, []int, error) {
+	ind, lines := make([]int, 0, preallocSize(n)), make([]int, 0, preallocSize(n))
+	err := r.read(n, f, func(k int, field []byte) error {
+		i, err := parseInt(field)
+		if err != nil {
+			return err
+		}
+		ind, lines = append(ind, i), append(lines, r.matrix.line)
+		return nil
+	})
+	return ind, lines, err
+}
+
+// parseHBInts parses the white space separated integers of a header line,
+// requiring at least `min` of these. Absent values are returned as zero.
+func parseHBInts(s string, min int, values ...*int) error {
+	fields := strings.Fields(s)
+	if len(fields) < min || len(fields) > len(values) {
+		return fmt.Errorf("%w: expected %d to %d values, got %d", ErrInvalidHeader, min, len(values), len(fields))
+	}
+	for k, field := range fields {
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		*values[k] = v
+	}
+	return nil
+}
+
+// column returns the trimmed characters `[start, end)` of a fixed-width line.
+func column(line string, start, end int) string {
+	if start > len(line) {
+		return ""
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	return strings.TrimSpace(line[start:end])
+}
+
+// parseHBHeader parses the four or five header lines of the Harwell-Boeing
+// format, and sets the value type, symmetry, and dimensions of the matrix.
+func (matrix *Matrix) parseHBHeader(r *hbReader) error {
+	hb := &HBHeader{}
+
+	// title and key
+	b, err := r.next(SectionHeader)
+	if err != nil {
+		return err
+	}
+	line := string(b)
+	hb.Title, hb.Key = column(line, 0, 72), column(line, 72, 80)
+
+	// number of lines per section, the right-hand sides are optional
+	if b, err = r.next(SectionHeader); err != nil {
+		return err
+	}
+	line = string(b)
+	err = parseHBInts(line, 4, &hb.TotalLines, &hb.PointerLines, &hb.IndexLines, &hb.ValueLines, &hb.RHSLines)
+	if err != nil {
+		return matrix.parseError(SectionHeader, line, err)
+	}
+
+	// matrix type and dimensions, the number of elements is optional
+	if b, err = r.next(SectionHeader); err != nil {
+		return err
+	}
+	line = string(b)
+	hb.Type = strings.ToUpper(column(line, 0, 3))
+	if err := parseHBInts(column(line, 3, len(line)), 3, &hb.Rows, &hb.Cols, &hb.NNZ, &hb.Elements); err != nil {
+		return matrix.parseError(SectionHeader, line, err)
+	}
+	if err := matrix.setHBType(hb.Type); err != nil {
+		return matrix.parseError(SectionHeader, line, err)
+	}
+	if err := checkDims(hb.Rows, hb.Cols); err != nil {
+		return matrix.parseError(SectionHeader, line, err)
+	}
+	if err := checkSquare(matrix.Symmetry, hb.Rows, hb.Cols); err != nil {
+		return matrix.parseError(SectionHeader, line, err)
+	}
+	if err := checkLines(hb.NNZ); err != nil {
+		return matrix.parseError(SectionHeader, line, err)
+	}
+
+	// formats of the sections
+	if b, err = r.next(SectionHeader); err != nil {
+		return err
+	}
+	line = string(b)
+	hb.PointerFormat, hb.IndexFormat = column(line, 0, 16), column(line, 16, 32)
+	hb.ValueFormat, hb.RHSFormat = column(line, 32, 52), column(line, 52, 72)
+
+	// only the formats of present sections are required
+	formats := []struct {
+		f       *fortranFormat
+		s       string
+		present bool
+	}{
+		{f: &r.ptrFmt, s: hb.PointerFormat, present: true},
+		{f: &r.indFmt, s: hb.IndexFormat, present: true},
+		{f: &r.valFmt, s: hb.ValueFormat, present: matrix.Type != TypePattern},
+		{f: &r.rhsFmt, s: hb.RHSFormat, present: hb.RHSLines > 0},
+	}
+	for _, format := range formats {
+		if !format.present {
+			continue
+		}
+		if *format.f, err = parseFortranFormat(format.s); err != nil {
+			return matrix.parseError(SectionHeader, line, err)
+		}
+	}
+
+	// description of the right-hand sides
+	if hb.RHSLines > 0 {
+		if b, err = r.next(SectionHeader); err != nil {
+			return err
+		}
+		line = string(b)
+		hb.RHSType = strings.ToUpper(column(line, 0, 3))
+		if err := parseHBInts(column(line, 3, len(line)), 1, &hb.RHS, &hb.RHSIndices); err != nil {
+			return matrix.parseError(SectionHeader, line, err)
+		}
+		if hb.RHSType == "" || !strings.ContainsRune("FM", rune(hb.RHSType[0])) {
+			err := fmt.Errorf("%w: unsupported right-hand side type %#v", ErrInvalidHeader, hb.RHSType)
+			return matrix.parseError(SectionHeader, line, err)
+		}
+	}
+
+	matrix.hb = hb
+	matrix.comment = hb.Title
+	matrix.Object = ObjectMatrix
+	matrix.Format = FormatCoordinate
+	matrix.n, matrix.m = hb.Rows, hb.Cols
+	matrix.lines = hb.NNZ
+	return nil
+}
+
+// setHBType sets the value type and symmetry from the matrix type code.
+func (matrix *Matrix) setHBType(code string) error {
+	if len(code) != 3 {
+		return fmt.Errorf("%w: invalid matrix type %#v", ErrInvalidHeader, code)
+	}
+
+	switch code[0] {
+	case 'R':
+		matrix.Type = TypeReal
+	case 'C':
+		matrix.Type = TypeComplex
+	case 'P':
+		matrix.Type = TypePattern
+	case 'I':
+		matrix.Type = TypeInteger
+	default:
+		return fmt.Errorf("%w: matrix type %#v", ErrUnsupportedType, code)
+	}
+
+	switch code[1] {
+	case 'U', 'R':
+		matrix.Symmetry = General
+	case 'S':
+		matrix.Symmetry = Symmetric
+	case 'Z':
+		matrix.Symmetry = SkewSymmetric
+	case 'H':
+		matrix.Symmetry = Hermitian
+	default:
+		return fmt.Errorf("%w: matrix type %#v", ErrUnsupportedSymmetry, code)
+	}
+
+	if code[2] != 'A' {
+		return fmt.Errorf("%w: matrix type %#v, only assembled matrices are supported", ErrUnsupportedFormat, code)
+	}
+	return nil
+}
+
+// parseHarwellBoeing performs all parsing steps of the Harwell-Boeing format.
+// The matrix type is verified to match whether a complex matrix is requested.
+func (matrix *Matrix) parseHarwellBoeing(rd io.Reader, complex bool) error {
+	r := &hbReader{matrix: matrix, scanner: matrix.newScanner(rd)}
+	if err := matrix.parseHBHeader(r); err != nil {
+		return err
+	}
+
+	if complex && matrix.Type != TypeComplex {
+		err := fmt.Errorf("%w: expected %#v, got %#v", ErrUnsupportedType, TypeComplex, matrix.Type)
+		return matrix.parseError(SectionHeader, "", err)
+	}
+	if !complex && matrix.Type == TypeComplex {
+		err := fmt.Errorf("%w: %#v requires ParseHarwellBoeingComplex", ErrUnsupportedType, TypeComplex)
+		return matrix.parseError(SectionHeader, "", err)
+	}
+
+	hb := matrix.hb
+	ptr, err := r.readPointers(hb.Cols+1, hb.NNZ, r.ptrFmt)
+	if err != nil {
+		return err
+	}
+	ind, lines, err := r.readIndices(hb.NNZ, r.indFmt)
+	if err != nil {
+		return err
+	}
+
+	if complex {
+		values, err := r.readValues(2*hb.NNZ, r.valFmt)
+		if err != nil {
+			return err
+		}
+		return matrix.assembleHBComplex(ptr, ind, lines, values)
+	}
+
+	var values []float64
+	if matrix.Type != TypePattern {
+		if values, err = r.readValues(hb.NNZ, r.valFmt); err != nil {
+			return err
+		}
+	}
+	if err := matrix.assembleHB(ptr, ind, lines, values); err != nil {
+		return err
+	}
+
+	if hb.RHSLines > 0 {
+		return matrix.parseHBVectors(r)
+	}
+	return nil
+}
+
+// assembleHB forms the CSR matrix from the compressed columns. The values are
+// absent for `TypePattern`.
+func (matrix *Matrix) assembleHB(ptr, ind, lines []int, values []float64) error {
+	t := newTriplets(len(ind))
+	for j := 0; j+1 < len(ptr); j++ {
+		for k := ptr[j] - 1; k < ptr[j+1]-1; k++ {
+			matrix.line = lines[k]
+			if ok, err := matrix.checkEntry(k+1, ind[k], j+1); !ok {
+				if err != nil {
+					return matrix.parseError(SectionData, "", err)
+				}
+				continue
+			}
+
+			v := 1.0
+			if values != nil {
+				v = values[k]
+			}
+			if v == 0 {
+				matrix.zeros++
+			}
+
+			// correct for one-base
+			t.I, t.J, t.V = append(t.I, ind[k]-1), append(t.J, j), append(t.V, v)
+			t.lines = append(t.lines, lines[k])
+		}
+	}
+	return matrix.assemble(t)
+}
+
+// assembleHBComplex forms the `ComplexCSR` from the compressed columns, with
+// the real and imaginary parts of each value stored consecutively.
+func (matrix *Matrix) assembleHBComplex(ptr, ind, lines []int, values []float64) error {
+	nnz := len(ind)
+	I, J, V := make([]int, 0, nnz), make([]int, 0, nnz), make([]complex128, 0, nnz)
+	clines := make([]int, 0, nnz)
+	for j := 0; j+1 < len(ptr); j++ {
+		for k := ptr[j] - 1; k < ptr[j+1]-1; k++ {
+			matrix.line = lines[k]
+			if ok, err := matrix.checkEntry(k+1, ind[k], j+1); !ok {
+				if err != nil {
+					return matrix.parseError(SectionData, "", err)
+				}
+				continue
+			}
+
+			v := complex(values[2*k], values[2*k+1])
+			if v == 0 {
+				matrix.zeros++
+			}
+
+			// correct for one-base
+			I, J, V = append(I, ind[k]-1), append(J, j), append(V, v)
+			clines = append(clines, lines[k])
+		}
+	}
+	return matrix.assembleComplex(I, J, V, clines)
+}
+
+// parseHBVectors parses the right-hand sides, and the optional initial
+// guesses and exact solutions. Sparse right-hand sides use the pointer and
+// index formats of the matrix.
+func (matrix *Matrix) parseHBVectors(r *hbReader) error {
+	hb := matrix.hb
+	n, nrhs := hb.Rows, hb.RHS
+
+	// full vectors are stored consecutively
+	full := func() ([]mat.Vector, error) {
+		values, err := r.readValues(n*nrhs, r.rhsFmt)
+		if err != nil {
+			return nil, err
+		}
+		vecs := make([]mat.Vector, nrhs)
+		for k := range vecs {
+			vecs[k] = mat.NewVecDense(n, values[k*n:(k+1)*n])
+		}
+		return vecs, nil
+	}
+
+	var err error
+	if hb.RHSType[0] == 'F' {
+		if matrix.rhs, err = full(); err != nil {
+			return err
+		}
+	} else {
+		ptr, err := r.readPointers(nrhs+1, hb.RHSIndices, r.ptrFmt)
+		if err != nil {
+			return err
+		}
+		ind, lines, err := r.readIndices(hb.RHSIndices, r.indFmt)
+		if err != nil {
+			return err
+		}
+		values, err := r.readValues(hb.RHSIndices, r.rhsFmt)
+		if err != nil {
+			return err
+		}
+
+		matrix.rhs = make([]mat.Vector, nrhs)
+		for k := range matrix.rhs {
+			start, end := ptr[k]-1, ptr[k+1]-1
+			idx := make([]int, 0, end-start)
+			for p := start; p < end; p++ {
+				if ind[p] < 1 || ind[p] > n {
+					matrix.line = lines[p]
+					err := fmt.Errorf("%w: right-hand side %d: index %d exceeds %d", ErrIndexOutOfRange, k+1, ind[p], n)
+					return matrix.parseError(SectionData, "", err)
+				}
+				idx = append(idx, ind[p]-1)
+			}
+			matrix.rhs[k] = sparse.NewVector(n, idx, values[start:end])
+		}
+	}
+
+	if strings.ContainsRune(hb.RHSType[1:], 'G') {
+		if matrix.guess, err = full(); err != nil {
+			return err
+		}
+	}
+	if strings.ContainsRune(hb.RHSType[1:], 'X') {
+		if matrix.exact, err = full(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hbEntry is a stored entry of a column that is written in the
+// Harwell-Boeing format.
+type hbEntry struct {
+	i int
+	v float64
+}
+
+// SaveToHarwellBoeing writes a `mat.Matrix` interface towards the
+// Harwell-Boeing format. The title, key, matrix type code, and the pointer,
+// index, and value formats are taken from the header, all other fields are
+// derived from the matrix. The type code defaults to `RUA`. Supported are real
+// (`R`), integer (`I`), and pattern (`P`) assembled matrices that are
+// unsymmetric (`U`), rectangular (`R`), symmetric (`S`), or skew-symmetric
+// (`Z`). For the latter two only the lower-triangular part is written, and the
+// matrix is verified to have the requested symmetry. The formats default to
+// the narrowest integer formats that fit and `(3E25.16)` for the values, which
+// preserves these exactly. Right-hand sides are not written, such that the
+// output is valid in the Rutherford-Boeing format as well.
+func SaveToHarwellBoeing(matrix mat.Matrix, wr io.Writer, header HBHeader) error {
+	hb := HBHeader{
+		Title:         header.Title,
+		Key:           header.Key,
+		Type:          strings.ToUpper(header.Type),
+		PointerFormat: header.PointerFormat,
+		IndexFormat:   header.IndexFormat,
+		ValueFormat:   header.ValueFormat,
+	}
+	if hb.Type == "" {
+		hb.Type = "RUA"
+	}
+
+	// the value type and symmetry of the type code
+	cfg := &Matrix{}
+	if err := cfg.setHBType(hb.Type); err != nil {
+		return err
+	}
+	if cfg.Type == TypeComplex || cfg.Symmetry == Hermitian {
+		return fmt.Errorf("Unsupported type for writing: %v", hb.Type)
+	}
+	if cfg.Type == TypePattern && cfg.Symmetry == SkewSymmetric {
+		return fmt.Errorf("Type %#v does not support symmetry %#v", TypePattern, SkewSymmetric)
+	}
+
+	sp, ok := nonZeros(matrix)
+	if !ok {
+		sp = denseNonZeros{matrix}
+	}
+	if !hasSymmetry(sp, cfg.Symmetry) {
+		return fmt.Errorf("Matrix does not satisfy symmetry %#v", cfg.Symmetry)
+	}
+
+	// the stored entries per column, ordered by row
+	n, m := sp.Dims()
+	cols := make([][]hbEntry, m)
+	sp.DoNonZero(func(i, j int, v float64) {
+		if isStored(i, j, cfg.Symmetry) {
+			cols[j] = append(cols[j], hbEntry{i: i, v: v})
+		}
+	})
+
+	ptr := make([]float64, 1, m+1)
+	var ind, values []float64
+	ptr[0] = 1
+	for _, col := range cols {
+		sort.Slice(col, func(a, b int) bool { return col[a].i < col[b].i })
+		for _, e := range col {
+			ind = append(ind, float64(e.i+1))
+			values = append(values, e.v)
+		}
+		ptr = append(ptr, float64(len(ind)+1))
+	}
+	hb.Rows, hb.Cols, hb.NNZ = n, m, len(ind)
+
+	// default formats fit the largest value of each section
+	if hb.PointerFormat == "" {
+		hb.PointerFormat = intFormat(hb.NNZ + 1)
+	}
+	if hb.IndexFormat == "" {
+		hb.IndexFormat = intFormat(n)
+	}
+	if hb.ValueFormat == "" && cfg.Type == TypeInteger {
+		max := 0.0
+		for _, v := range values {
+			max = math.Max(max, math.Abs(v))
+		}
+		hb.ValueFormat = intFormat(-int(max))
+	} else if hb.ValueFormat == "" && cfg.Type != TypePattern {
+		hb.ValueFormat = "(3E25.16)"
+	}
+
+	// format all sections before writing any output
+	sections := []struct {
+		name   string
+		format string
+		width  int
+		values []float64
+		fields []string
+		f      fortranFormat
+		lines  int
+	}{
+		{name: "pointer", format: hb.PointerFormat, width: 16, values: ptr},
+		{name: "index", format: hb.IndexFormat, width: 16, values: ind},
+		{name: "value", format: hb.ValueFormat, width: 20, values: values},
+	}
+	if cfg.Type == TypePattern {
+		sections = sections[:2]
+	}
+
+	for k := range sections {
+		s := &sections[k]
+		f, err := parseFortranFormat(s.format)
+		if err != nil {
+			return err
+		}
+		if len(s.format) > s.width || (k < 2 && f.kind != "I") {
+			return fmt.Errorf("Unsupported %s format for writing: %v", s.name, s.format)
+		}
+
+		s.fields = make([]string, len(s.values))
+		for p, v := range s.values {
+			if s.fields[p], err = formatFortranValue(v, f); err != nil {
+				return fmt.Errorf("Entry %d of %s section: %w", p+1, s.name, err)
+			}
+		}
+		s.f = f
+		s.lines = (len(s.fields) + f.count - 1) / f.count
+		hb.TotalLines += s.lines
+	}
+	hb.PointerLines, hb.IndexLines = sections[0].lines, sections[1].lines
+	if len(sections) > 2 {
+		hb.ValueLines = sections[2].lines
+	}
+
+	// buffered output, write errors are retained till flushing
+	buf := bufio.NewWriter(wr)
+	writeHBLine(buf, fmt.Sprintf("%-72.72s%-8.8s", hb.Title, hb.Key))
+	writeHBLine(buf, fmt.Sprintf("%14d%14d%14d%14d%14d", hb.TotalLines, hb.PointerLines, hb.IndexLines, hb.ValueLines, 0))
+	writeHBLine(buf, fmt.Sprintf("%-3s%11s%14d%14d%14d%14d", hb.Type, "", hb.Rows, hb.Cols, hb.NNZ, 0))
+	writeHBLine(buf, fmt.Sprintf("%-16s%-16s%-20s", hb.PointerFormat, hb.IndexFormat, hb.ValueFormat))
+
+	for _, s := range sections {
+		for k := 0; k < len(s.fields); k += s.f.count {
+			end := k + s.f.count
+			if end > len(s.fields) {
+				end = len(s.fields)
+			}
+			writeHBLine(buf, strings.Join(s.fields[k:end], ""))
+		}
+	}
+	return buf.Flush()
+}
+
+// writeHBLine writes a line of the Harwell-Boeing format without trailing
+// white space.
+func writeHBLine(buf *bufio.Writer, line string) {
+	buf.WriteString(strings.TrimRight(line, " "))
+	buf.WriteByte('\n')
+}
+
+// intFormat returns the integer format with the most fields per line of 80
+// characters that fits values up to `max`, or down to `-max` for negative
+// `max`.
+func intFormat(max int) string {
+	width := len(strconv.Itoa(max)) + 1
+	return fmt.Sprintf("(%dI%d)", 80/width, width)
+}
+
+// formatFortranValue formats a value right-aligned in a field of the format.
+// Integer formats require integral values. Exponential formats write a single
+// digit before the decimal point, as with a scale factor of one, which reads
+// identically for any scale factor. Fixed-point formats are scaled by
+// `10^scale`.
+func formatFortranValue(v float64, f fortranFormat) (string, error) {
+	var s string
+	switch f.kind {
+	case "I":
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt64 {
+			return "", fmt.Errorf("Value %v is not an integer", v)
+		}
+		s = strconv.FormatInt(int64(v), 10)
+	case "F":
+		s = strconv.FormatFloat(v*math.Pow10(f.scale), 'f', f.precision, 64)
+	case "D":
+		s = strings.Replace(strconv.FormatFloat(v, 'E', f.precision, 64), "E", "D", 1)
+	default:
+		s = strconv.FormatFloat(v, 'E', f.precision, 64)
+	}
+	if len(s) > f.width {
+		return "", fmt.Errorf("Value %v exceeds the field width %d", v, f.width)
+	}
+	return strings.Repeat(" ", f.width-len(s)) + s, nil
+}
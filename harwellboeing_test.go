@@ -0,0 +1,513 @@
+package gomm
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/james-bowman/sparse"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Harwell-Boeing test matrices, with fields of the full width of the formats
+// and exponents without exponent letter.
+const hbRUA = `Unsymmetric test matrix                                                 TESTRUA1
+            10             2             2             3             3
+RUA                        4             4             7             0
+(3I4)           (4I3)           (1P,3E12.4)         (4E10.3)
+FGX                        1             0
+   1   3   4
+   6   8
+  1  3  2  3
+  4  1  4
+  1.0000E+00  0.3000+001  2.0000D+00
+5.000000E+00  6.0000E+00  4.0000E+00
+  7.0000E+00
+ 1.000E+00 2.000E+00 3.000E+00 4.000E+00
+ 0.000E+00 0.000E+00 0.000E+00 0.000E+00
+ 1.000E+00 1.000E+00 1.000E+00 1.000E+00
+`
+
+const hbRSA = `Symmetric test matrix                                                   TESTRSA1
+             6             1             1             1             3
+RSA                        3             3             5             0
+(10I8)          (10I8)          (5E16.8)            (5E16.8)
+M                          1             2
+       1       3       5       6
+       1       2       2       3       3
+  4.00000000E+00  1.00000000E+00  4.00000000E+00  1.00000000E+00  4.00000000E+00
+       1       3
+       1       3
+  1.00000000E+00  2.00000000E+00
+`
+
+const hbPSA = `Pattern test matrix                                                     TESTPSA1
+             2             1             1             0
+PSA                        3             3             4
+(10I8)          (10I8)
+       1       3       4       5
+       1       3       2       3
+`
+
+const hbCUA = `Complex test matrix                                                     TESTCUA1
+             3             1             1             1
+CUA                        2             2             2             0
+(10I8)          (10I8)          (4E20.12)
+       1       2       3
+       1       2
+  1.000000000000E+00  2.000000000000E+00  3.000000000000E+00 -1.000000000000E+00
+`
+
+func TestParseHarwellBoeing(t *testing.T) {
+	entries := []struct {
+		hb, mm string
+	}{
+		{
+			hb: hbRUA,
+			mm: `%%MatrixMarket matrix coordinate real general
+4 4 7
+1 1 1.0
+3 1 3.0
+2 2 2.0
+3 3 5.0
+4 3 6.0
+1 4 4.0
+4 4 7.0
+`,
+		},
+		{
+			hb: hbRSA,
+			mm: `%%MatrixMarket matrix coordinate real symmetric
+3 3 5
+1 1 4.0
+2 1 1.0
+2 2 4.0
+3 2 1.0
+3 3 4.0
+`,
+		},
+		{
+			hb: hbPSA,
+			mm: `%%MatrixMarket matrix coordinate pattern symmetric
+3 3 4
+1 1
+3 1
+2 2
+3 3
+`,
+		},
+	}
+
+	for _, e := range entries {
+		ref := &Matrix{}
+		exp, err := ref.Parse(strings.NewReader(e.mm))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matrix := &Matrix{}
+		smat, err := matrix.ParseHarwellBoeing(strings.NewReader(e.hb))
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", e.hb, err)
+		}
+		if _, ok := smat.(*sparse.CSR); !ok {
+			t.Errorf("Expected %T, got %T", &sparse.CSR{}, smat)
+		}
+		if !mat.Equal(exp, smat) {
+			t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(exp), mat.Formatted(smat))
+		}
+		if matrix.NNZ() != ref.NNZ() {
+			t.Errorf("Wrong number of non-zero entries: exp %d, got %d", ref.NNZ(), matrix.NNZ())
+		}
+		if matrix.Type != ref.Type || matrix.Symmetry != ref.Symmetry {
+			t.Errorf("Wrong type: exp %v %v, got %v %v", ref.Type, ref.Symmetry, matrix.Type, matrix.Symmetry)
+		}
+	}
+}
+
+func TestParseHarwellBoeingHeader(t *testing.T) {
+	matrix := &Matrix{}
+	if _, err := matrix.ParseHarwellBoeing(strings.NewReader(hbRUA)); err != nil {
+		t.Fatal(err)
+	}
+
+	hb := matrix.HarwellBoeing()
+	exp := HBHeader{
+		Title:         "Unsymmetric test matrix",
+		Key:           "TESTRUA1",
+		Type:          "RUA",
+		TotalLines:    10,
+		PointerLines:  2,
+		IndexLines:    2,
+		ValueLines:    3,
+		RHSLines:      3,
+		Rows:          4,
+		Cols:          4,
+		NNZ:           7,
+		PointerFormat: "(3I4)",
+		IndexFormat:   "(4I3)",
+		ValueFormat:   "(1P,3E12.4)",
+		RHSFormat:     "(4E10.3)",
+		RHSType:       "FGX",
+		RHS:           1,
+	}
+	if hb == nil || *hb != exp {
+		t.Errorf("Wrong header: exp %+v, got %+v", exp, hb)
+	}
+	if matrix.Comment() != exp.Title {
+		t.Errorf("Wrong comment: exp %q, got %q", exp.Title, matrix.Comment())
+	}
+}
+
+func TestParseHarwellBoeingVectors(t *testing.T) {
+	entries := []struct {
+		hb                string
+		rhs, guess, exact []float64
+	}{
+		{
+			hb:    hbRUA,
+			rhs:   []float64{1, 2, 3, 4},
+			guess: []float64{0, 0, 0, 0},
+			exact: []float64{1, 1, 1, 1},
+		},
+		{
+			hb:  hbRSA,
+			rhs: []float64{1, 0, 2},
+		},
+		{
+			hb: hbPSA,
+		},
+	}
+
+	for _, e := range entries {
+		matrix := &Matrix{}
+		if _, err := matrix.ParseHarwellBoeing(strings.NewReader(e.hb)); err != nil {
+			t.Fatal(err)
+		}
+
+		vectors := []struct {
+			got []mat.Vector
+			exp []float64
+		}{
+			{got: matrix.RHS(), exp: e.rhs},
+			{got: matrix.Guess(), exp: e.guess},
+			{got: matrix.Exact(), exp: e.exact},
+		}
+		for _, v := range vectors {
+			if v.exp == nil {
+				if len(v.got) != 0 {
+					t.Errorf("Unexpected vectors: %v", v.got)
+				}
+				continue
+			}
+			if len(v.got) != 1 {
+				t.Fatalf("Wrong number of vectors: exp 1, got %d", len(v.got))
+			}
+			if !mat.Equal(v.got[0], mat.NewVecDense(len(v.exp), v.exp)) {
+				t.Errorf("Wrong vector: exp %v, got %v", v.exp, mat.Formatted(v.got[0].T()))
+			}
+		}
+	}
+
+	// sparse right-hand sides
+	matrix := &Matrix{}
+	if _, err := matrix.ParseHarwellBoeing(strings.NewReader(hbRSA)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := matrix.RHS()[0].(*sparse.Vector); !ok {
+		t.Errorf("Expected %T, got %T", &sparse.Vector{}, matrix.RHS()[0])
+	}
+}
+
+func TestParseHarwellBoeingComplex(t *testing.T) {
+	matrix := &Matrix{}
+	cmat, err := matrix.ParseHarwellBoeingComplex(strings.NewReader(hbCUA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmat.At(0, 0) != 1+2i || cmat.At(1, 1) != 3-1i || cmat.At(0, 1) != 0 {
+		t.Errorf("Wrong content: got %v, %v", cmat.At(0, 0), cmat.At(1, 1))
+	}
+
+	// the value type is verified
+	if _, err := (&Matrix{}).ParseHarwellBoeing(strings.NewReader(hbCUA)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected error %v, got: %v", ErrUnsupportedType, err)
+	}
+	if _, err := (&Matrix{}).ParseHarwellBoeingComplex(strings.NewReader(hbRUA)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected error %v, got: %v", ErrUnsupportedType, err)
+	}
+}
+
+func TestParseHarwellBoeingErrors(t *testing.T) {
+	entries := []struct {
+		str  string
+		err  error
+		line int
+	}{
+		{
+			str:  strings.Replace(hbRUA, "\nRUA", "\nRUE", 1),
+			err:  ErrUnsupportedFormat,
+			line: 3,
+		},
+		{
+			str:  strings.Replace(hbRUA, "\nRUA", "\nXUA", 1),
+			err:  ErrUnsupportedType,
+			line: 3,
+		},
+		{
+			str:  strings.Replace(hbRUA, "RUA                        4             4             7", "RUA                       -4             4             7", 1),
+			err:  ErrInvalidSize,
+			line: 3,
+		},
+		{
+			str:  strings.Replace(hbRUA, "RUA                        4             4", "RSA                        4             5", 1),
+			err:  ErrInvalidSize,
+			line: 3,
+		},
+		{
+			str:  strings.Replace(hbRUA, "(4I3)", "(4A3)", 1),
+			err:  ErrInvalidHeader,
+			line: 4,
+		},
+		{
+			str:  strings.Replace(hbRUA, "   1   3   4\n", "   1   4   3\n", 1),
+			err:  ErrInvalidEntry,
+			line: 6,
+		},
+		{
+			str:  strings.Replace(hbRUA, "  4  1  4\n", "  4  1  5\n", 1),
+			err:  ErrIndexOutOfRange,
+			line: 9,
+		},
+		{
+			str:  strings.Replace(hbRUA, "  7.0000E+00", "  7.0000X+00", 1),
+			line: 12,
+		},
+		{
+			str:  strings.Replace(hbRUA, "  7.0000E+00", "         NaN", 1),
+			err:  ErrNonFinite,
+			line: 12,
+		},
+		{
+			str:  hbRUA[:strings.Index(hbRUA, "  7.0000E+00")],
+			err:  ErrUnexpectedEOF,
+			line: 12,
+		},
+		{
+			str:  "Title\n",
+			err:  ErrUnexpectedEOF,
+			line: 2,
+		},
+	}
+
+	for _, e := range entries {
+		_, err := (&Matrix{}).ParseHarwellBoeing(strings.NewReader(e.str))
+		if err == nil || (e.err != nil && !errors.Is(err, e.err)) {
+			t.Errorf("Expected error %v for %q, got: %v", e.err, e.str, err)
+			continue
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != e.line {
+			t.Errorf("Expected error on line %d, got: %v", e.line, err)
+		}
+	}
+}
+
+func TestParseFortranFormat(t *testing.T) {
+	entries := []struct {
+		str string
+		exp fortranFormat
+	}{
+		{str: "(10I8)", exp: fortranFormat{count: 10, width: 8, kind: "I"}},
+		{str: "(4E20.12)", exp: fortranFormat{count: 4, width: 20, precision: 12, kind: "E"}},
+		{str: "(1P,4E20.12)", exp: fortranFormat{count: 4, width: 20, precision: 12, scale: 1, kind: "E"}},
+		{str: "(1P5D16.8)", exp: fortranFormat{count: 5, width: 16, precision: 8, scale: 1, kind: "D"}},
+		{str: " (3f25.16) ", exp: fortranFormat{count: 3, width: 25, precision: 16, kind: "F"}},
+		{str: "(E26.18E3)", exp: fortranFormat{count: 1, width: 26, precision: 18, kind: "E"}},
+		{str: "(4ES20.12)", exp: fortranFormat{count: 4, width: 20, precision: 12, kind: "ES"}},
+	}
+
+	for _, e := range entries {
+		f, err := parseFortranFormat(e.str)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", e.str, err)
+		}
+		if f != e.exp {
+			t.Errorf("Wrong format for %q: exp %+v, got %+v", e.str, e.exp, f)
+		}
+	}
+
+	for _, str := range []string{"", "(10A8)", "10I8", "(0I8)", "(3(1X,E23.15))"} {
+		if _, err := parseFortranFormat(str); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Expected error %v for %q, got: %v", ErrInvalidHeader, str, err)
+		}
+	}
+}
+
+func TestParseFortranValue(t *testing.T) {
+	entries := []struct {
+		str   string
+		scale int
+		v     float64
+	}{
+		{str: "1.5E+00", v: 1.5},
+		{str: "1.5D+02", v: 150},
+		{str: "1.5+002", v: 150},
+		{str: "-1.5-100", v: -1.5e-100},
+		{str: "15.0", scale: 1, v: 1.5},
+		{str: "1.5E+00", scale: 1, v: 1.5},
+		{str: "-3", v: -3},
+	}
+
+	for _, e := range entries {
+		v, err := parseFortranValue([]byte(e.str), e.scale)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", e.str, err)
+		}
+		if math.Abs(v-e.v) > 1e-15*math.Abs(e.v) {
+			t.Errorf("Wrong value for %q: exp %v, got %v", e.str, e.v, v)
+		}
+	}
+
+	if _, err := parseFortranValue([]byte("1.5x+00"), 0); err == nil {
+		t.Errorf("Expected error for %q", "1.5x+00")
+	}
+}
+
+func TestWriteHarwellBoeing(t *testing.T) {
+	csr := sparse.NewCSR(3, 3, []int{0, 1, 2, 4}, []int{0, 1, 0, 2}, []float64{1, 2, 3, -4.5})
+	exp := `Test matrix                                                             TESTKEY
+             4             1             1             2             0
+RUA                        3             3             4             0
+(40I2)          (40I2)          (3E25.16)
+ 1 3 4 5
+ 1 3 2 3
+   1.0000000000000000E+00   3.0000000000000000E+00   2.0000000000000000E+00
+  -4.5000000000000000E+00
+`
+
+	// the type code defaults to RUA and is written in upper case
+	for _, typ := range []string{"", "RUA", "rua"} {
+		var buf bytes.Buffer
+		if err := SaveToHarwellBoeing(csr, &buf, HBHeader{Title: "Test matrix", Key: "TESTKEY", Type: typ}); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != exp {
+			t.Errorf("Wrong output for type %q: exp\n%s\ngot\n%s", typ, exp, buf.String())
+		}
+	}
+}
+
+func TestWriteHarwellBoeingRoundTrip(t *testing.T) {
+	dense := mat.NewDense(4, 3, []float64{
+		1, 0, -2.5e-300,
+		0, math.Pi, 0,
+		4, 0, 1e300,
+		0, -1.0 / 3, 7,
+	})
+	sym := mat.NewSymDense(3, []float64{
+		4, 1, 0,
+		1, 4, -1,
+		0, -1, 4,
+	})
+	skew := mat.NewDense(3, 3, []float64{
+		0, 2, 0,
+		-2, 0, -3,
+		0, 3, 0,
+	})
+	ints := mat.NewDense(2, 2, []float64{1, -1000, 0, 42})
+	coo := sparse.NewCOO(3, 3, []int{0, 2, 0, 2, 1}, []int{0, 0, 2, 2, 1}, []float64{1, 1, 1, 1, 1})
+
+	entries := []struct {
+		matrix mat.Matrix
+		header HBHeader
+	}{
+		{matrix: dense},
+		{matrix: sparse.NewCSR(3, 3, []int{0, 1, 2, 4}, []int{0, 1, 0, 2}, []float64{1, 2, 3, 4})},
+		{matrix: sparse.NewCSC(3, 3, []int{0, 2, 3, 4}, []int{0, 2, 1, 2}, []float64{1, 3, 2, 4})},
+		{matrix: dense, header: HBHeader{Type: "RRA", ValueFormat: "(1P,4E20.12)"}},
+		{matrix: sym, header: HBHeader{Type: "RSA", PointerFormat: "(10I8)", IndexFormat: "(10I8)", ValueFormat: "(5D16.8)"}},
+		{matrix: sym, header: HBHeader{Type: "rsa", ValueFormat: "(1P,8F10.3)"}},
+		{matrix: skew, header: HBHeader{Type: "RZA"}},
+		{matrix: ints, header: HBHeader{Type: "IUA"}},
+		{matrix: coo, header: HBHeader{Type: "PSA"}},
+	}
+
+	for _, e := range entries {
+		var buf bytes.Buffer
+		if err := SaveToHarwellBoeing(e.matrix, &buf, e.header); err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", e.header, err)
+		}
+
+		matrix := &Matrix{}
+		got, err := matrix.ParseHarwellBoeing(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", e.header, err)
+		}
+		if !mat.EqualApprox(e.matrix, got, 1e-12) {
+			t.Errorf("Wrong content for %+v: exp %v, got %v", e.header, mat.Formatted(e.matrix), mat.Formatted(got))
+		}
+		if e.header.ValueFormat == "" && !mat.Equal(e.matrix, got) {
+			t.Errorf("Values not preserved for %+v: exp %v, got %v", e.header, mat.Formatted(e.matrix), mat.Formatted(got))
+		}
+
+		hb := matrix.HarwellBoeing()
+		if e.header.Type != "" && hb.Type != strings.ToUpper(e.header.Type) {
+			t.Errorf("Wrong type: exp %v, got %v", e.header.Type, hb.Type)
+		}
+		if e.header.ValueFormat != "" && hb.ValueFormat != e.header.ValueFormat {
+			t.Errorf("Wrong value format: exp %v, got %v", e.header.ValueFormat, hb.ValueFormat)
+		}
+	}
+
+	// matrices of the collection are written identically
+	for _, str := range []string{hbRUA, hbRSA, hbPSA} {
+		matrix := &Matrix{}
+		exp, err := matrix.ParseHarwellBoeing(strings.NewReader(str))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := SaveToHarwellBoeing(exp, &buf, *matrix.HarwellBoeing()); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", str, err)
+		}
+		got, err := (&Matrix{}).ParseHarwellBoeing(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", str, err)
+		}
+		if !mat.Equal(exp, got) {
+			t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(exp), mat.Formatted(got))
+		}
+	}
+}
+
+func TestWriteHarwellBoeingErrors(t *testing.T) {
+	csr := sparse.NewCSR(2, 2, []int{0, 1, 2}, []int{1, 0}, []float64{1.5, 2})
+	entries := []struct {
+		matrix mat.Matrix
+		header HBHeader
+	}{
+		{matrix: csr, header: HBHeader{Type: "CUA"}},
+		{matrix: csr, header: HBHeader{Type: "RUE"}},
+		{matrix: csr, header: HBHeader{Type: "RSA"}},
+		{matrix: csr, header: HBHeader{Type: "PZA"}},
+		{matrix: csr, header: HBHeader{Type: "IUA"}},
+		{matrix: csr, header: HBHeader{PointerFormat: "(4E20.12)"}},
+		{matrix: csr, header: HBHeader{ValueFormat: "(4A20)"}},
+		{matrix: csr, header: HBHeader{ValueFormat: "(10E6.3)"}},
+		{matrix: mat.NewDense(2, 3, nil), header: HBHeader{Type: "RZA"}},
+	}
+
+	for _, e := range entries {
+		var buf bytes.Buffer
+		if err := SaveToHarwellBoeing(e.matrix, &buf, e.header); err == nil {
+			t.Errorf("Expected error for %+v", e.header)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("Unexpected output for %+v: %q", e.header, buf.String())
+		}
+	}
+}
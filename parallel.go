@@ -0,0 +1,253 @@
+package gomm
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// chunkSize is the number of bytes of the data section that is read at once
+// and handed to a worker when parsing in parallel.
+var chunkSize = 1 << 20
+
+// minParallelSort is the number of entries from which the rows are sorted
+// concurrently when parsing in parallel.
+var minParallelSort = 1 << 16
+
+// chunk holds a number of complete lines of the data section.
+type chunk struct {
+	index int
+	line  int // the line number preceding the first line
+	data  []byte
+}
+
+// chunkEntry is a triplet, with one-based indices, parsed from a chunk.
+type chunkEntry struct {
+	i, j int
+	v    float64
+	line int
+}
+
+// chunkResult holds the entries parsed from a chunk. Parsing a chunk stops at
+// the first line that fails to parse, its error is stored in `err`.
+type chunkResult struct {
+	chunk
+	entries []chunkEntry
+	end     int // the line number of the last parsed line
+	err     error
+	text    string
+}
+
+// parseParallel parses all lines of a `FormatCoordinate` matrix into
+// triplets, similar to `parseSerial`. The data section is split in chunks of
+// complete lines that are parsed on a pool of `GOMAXPROCS` workers. The parsed
+// chunks are merged in order of appearance and are only then validated, such
+// that the triplets and errors are identical to serial parsing.
+func (matrix *Matrix) parseParallel(rd io.Reader) (*triplets, error) {
+	workers := runtime.GOMAXPROCS(0)
+	max := matrix.maxLineLength()
+	chunks := make(chan chunk, workers)
+	results := make(chan chunkResult, workers)
+
+	// stops all goroutines when returning early, and waits for these to
+	// finish such that the reader is no longer used after returning
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	var readErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(chunks)
+		readErr = splitChunks(rd, matrix.line, max, chunks, done)
+	}()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				select {
+				case results <- parseChunk(c, matrix.Object, matrix.Type, max):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// merge results in order, these may arrive in any order
+	t := newTriplets(matrix.lines)
+	pending := make(map[int]chunkResult)
+	next, entries := 0, 0
+	for r := range results {
+		pending[r.index] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			var err error
+			if entries, err = matrix.mergeChunk(t, r, entries); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if readErr != nil {
+		return nil, matrix.scanError(SectionData, readErr)
+	}
+	if err := matrix.checkEntries(entries); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// splitChunks reads the data section in chunks of complete lines and sends
+// these on the channel, until the end of the reader or until done. Lines
+// exceeding the maximum length are rejected with `bufio.ErrTooLong`, as by
+// the scanner.
+func splitChunks(rd io.Reader, line, max int, chunks chan<- chunk, done <-chan struct{}) error {
+	var carry []byte
+	for index := 0; ; {
+		data := make([]byte, len(carry)+chunkSize)
+		copy(data, carry)
+		n, err := io.ReadFull(rd, data[len(carry):])
+		data = data[:len(carry)+n]
+
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		// cut after the last complete line, the remainder is carried over
+		carry = nil
+		if !eof {
+			cut := bytes.LastIndexByte(data, '\n') + 1
+			data, carry = data[:cut], data[cut:]
+			if len(carry) > max+1 {
+				return bufio.ErrTooLong
+			}
+		}
+
+		if len(data) > 0 {
+			select {
+			case chunks <- chunk{index: index, line: line, data: data}:
+			case <-done:
+				return nil
+			}
+			index++
+			line += bytes.Count(data, []byte{'\n'})
+		}
+
+		if eof {
+			return nil
+		}
+	}
+}
+
+// parseChunk parses all lines of the chunk into triplets. Blank lines are
+// skipped, and lines exceeding the maximum length are rejected.
+func parseChunk(c chunk, object, typ string, max int) chunkResult {
+	r := chunkResult{chunk: c, end: c.line}
+	r.entries = make([]chunkEntry, 0, bytes.Count(c.data, []byte{'\n'})+1)
+	data := c.data
+	for len(data) > 0 {
+		text := data
+		if k := bytes.IndexByte(data, '\n'); k >= 0 {
+			text, data = data[:k], data[k+1:]
+		} else {
+			data = nil
+		}
+
+		r.end++
+		if len(bytes.TrimSuffix(text, []byte{'\r'})) > max {
+			r.err = lineTooLong(max)
+			break
+		}
+		if isBlank(text) {
+			continue
+		}
+		i, j, v, err := splitEntry(text, object, typ)
+		if err != nil {
+			r.err, r.text = err, string(text)
+			break
+		}
+		r.entries = append(r.entries, chunkEntry{i: i, j: j, v: v, line: r.end})
+	}
+	return r
+}
+
+// lineText returns the text of the given line of the chunk.
+func (c chunk) lineText(line int) string {
+	lines := bytes.Split(c.data, []byte{'\n'})
+	return string(lines[line-c.line-1])
+}
+
+// mergeChunk validates the entries of the chunk and appends them to the
+// triplets. It returns the number of entries parsed so far.
+func (matrix *Matrix) mergeChunk(t *triplets, r chunkResult, entries int) (int, error) {
+	for _, e := range r.entries {
+		entries++
+		matrix.line = e.line
+		if err := matrix.addEntry(t, entries, e.i, e.j, e.v); err != nil {
+			return entries, matrix.parseError(SectionData, r.lineText(e.line), err)
+		}
+	}
+
+	matrix.line = r.end
+	if r.err != nil {
+		return entries, matrix.parseError(SectionData, r.text, r.err)
+	}
+	return entries, nil
+}
+
+// sortRows sorts the positions `perm[ptr[i]:ptr[i+1]]` of the entries of each
+// row `i` by column and position. The rows are split in ranges holding a
+// similar number of entries, which are sorted concurrently.
+func sortRows(I, J, perm, ptr []int, workers int) {
+	n := len(ptr) - 1
+	sortRange := func(start, end int) {
+		order := &entryOrder{I: I, J: J}
+		for i := start; i < end; i++ {
+			if order.perm = perm[ptr[i]:ptr[i+1]]; len(order.perm) > 1 {
+				sort.Sort(order)
+			}
+		}
+	}
+	if workers < 2 || len(perm) < minParallelSort {
+		sortRange(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for w, start := 0, 0; w < workers && start < n; w++ {
+		// the first row beyond the share of entries of this worker
+		share := ptr[n] * (w + 1) / workers
+		end := start + sort.SearchInts(ptr[start+1:n+1], share) + 1
+		if w == workers-1 {
+			end = n
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			sortRange(start, end)
+		}(start, end)
+		start = end
+	}
+	wg.Wait()
+}
@@ -0,0 +1,122 @@
+package gomm
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// generateCoordinate generates a `FormatCoordinate` matrix of dimensions
+// `(n, n)` with `nnz` randomly positioned entries, including duplicates.
+func generateCoordinate(n, nnz int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%%%%MatrixMarket matrix coordinate real general\n%d %d %d\n", n, n, nnz)
+	for k := 0; k < nnz; k++ {
+		fmt.Fprintf(&buf, "%d %d %g\n", rnd.Intn(n)+1, rnd.Intn(n)+1, rnd.NormFloat64())
+	}
+	return buf.Bytes()
+}
+
+func TestParseMatrixMarketParallel(t *testing.T) {
+	// small chunks to spread the lines over many workers, and sort the rows
+	// concurrently for any number of entries
+	defer func(size, sort int) { chunkSize, minParallelSort = size, sort }(chunkSize, minParallelSort)
+	chunkSize, minParallelSort = 16, 0
+
+	entries := []struct {
+		str     string
+		options ParseOptions
+	}{
+		{str: string(generateCoordinate(50, 1000))},
+		{str: string(generateCoordinate(50, 1000)), options: ParseOptions{Duplicates: KeepLastDuplicate}},
+		{str: string(generateCoordinate(50, 1000)), options: ParseOptions{Duplicates: RejectDuplicates}},
+		{
+			str: `%%MatrixMarket matrix coordinate real symmetric
+3 3 4
+1 1 1.0
+2 1 0.0
+3 1 3.0
+3 3 4.0`,
+			options: ParseOptions{Zeros: KeepZeros},
+		},
+		{str: "%%MatrixMarket matrix coordinate pattern general\n3 3 3\n1 1\n2 2\n3 3\n"},
+		{str: "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 2 x\n3 3 1.0\n"},
+		{str: "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n4 2 1.0\n3 3 1.0\n"},
+		{str: "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n4 2 1.0\n3 3 1.0\n", options: ParseOptions{Lenient: true}},
+		{str: "%%MatrixMarket matrix coordinate real general\n3 3 1\n1 1 1.0\n2 2 1.0\n"},
+		{str: "%%MatrixMarket matrix coordinate real general\n3 3 3\n1 1 1.0\n2 2 1.0\n"},
+		{str: "%%MatrixMarket matrix coordinate real general\n3 3 2\n1 1 1.0\n\n2 2 1.0\n"},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 2\n1 1 1.0\n2 2 " + strings.Repeat("1", 100) + "\n",
+			options: ParseOptions{MaxLineLength: 64},
+		},
+		{
+			str:     "%%MatrixMarket matrix coordinate real general\n3 3 2\n1 1 1.0\n2 2 " + strings.Repeat("1", 40) + "\n",
+			options: ParseOptions{MaxLineLength: 64},
+		},
+	}
+
+	for _, e := range entries {
+		serial := &Matrix{Options: e.options}
+		exp, expErr := serial.Parse(strings.NewReader(e.str))
+
+		e.options.Parallel = true
+		parallel := &Matrix{Options: e.options}
+		got, err := parallel.Parse(strings.NewReader(e.str))
+
+		if fmt.Sprint(err) != fmt.Sprint(expErr) {
+			t.Errorf("Wrong error: exp %v, got %v", expErr, err)
+			continue
+		}
+		if expErr != nil {
+			continue
+		}
+		if !mat.Equal(exp, got) {
+			t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(exp), mat.Formatted(got))
+		}
+		if serial.NNZ() != parallel.NNZ() {
+			t.Errorf("Wrong number of non-zero entries: exp %d, got %d", serial.NNZ(), parallel.NNZ())
+		}
+		if serial.Duplicates() != parallel.Duplicates() {
+			t.Errorf("Wrong number of duplicates: exp %d, got %d", serial.Duplicates(), parallel.Duplicates())
+		}
+		if serial.ExplicitZeros() != parallel.ExplicitZeros() {
+			t.Errorf("Wrong number of explicit zeros: exp %d, got %d", serial.ExplicitZeros(), parallel.ExplicitZeros())
+		}
+	}
+}
+
+// BenchmarkParseCoordinate parses matrices of up to 1e7 entries, or 1e6 with
+// `-short`. The matrix of 1e8 entries, which requires tens of gigabytes of
+// memory, is only included when `GOMM_BENCH_LARGE` is set.
+func BenchmarkParseCoordinate(b *testing.B) {
+	for _, nnz := range []int{1e6, 1e7, 1e8} {
+		if nnz > 1e6 && testing.Short() {
+			continue
+		}
+		if nnz > 1e7 && os.Getenv("GOMM_BENCH_LARGE") == "" {
+			continue
+		}
+		b.Run(fmt.Sprintf("nnz=%d", nnz), func(b *testing.B) {
+			data := generateCoordinate(nnz/10, nnz)
+			for _, parallel := range []bool{false, true} {
+				b.Run(fmt.Sprintf("parallel=%v", parallel), func(b *testing.B) {
+					b.SetBytes(int64(len(data)))
+					b.ReportAllocs()
+					for k := 0; k < b.N; k++ {
+						matrix := &Matrix{Options: ParseOptions{Parallel: parallel}}
+						if _, err := matrix.Parse(bytes.NewReader(data)); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
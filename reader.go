@@ -0,0 +1,230 @@
+package gomm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/cmplx"
+	"strings"
+)
+
+// Reader provides streaming access to the entries of a `MatrixMarket` file.
+// Instead of forming the complete matrix in memory, as `Parse` does, the
+// entries are returned one at a time by `Next`. This allows processing files
+// that do not fit in memory, or assembling entries into custom data
+// structures.
+//
+// The entries are returned as stored in the file: explicit zeros and
+// duplicate entries are not treated. The `ParseOptions.Lenient` option is
+// respected when validating indices and the number of entries.
+type Reader struct {
+	// ExpandSymmetry enables returning the mirrored counterpart of each
+	// off-diagonal entry of (skew-)symmetric and hermitian matrices, similar
+	// to the matrices formed by `Parse`. By default only the stored,
+	// lower-triangular, entries are returned.
+	ExpandSymmetry bool
+
+	matrix  *Matrix
+	scanner *bufio.Scanner
+	entries int
+
+	// the position of the next value of `FormatArray` matrices
+	row, col int
+
+	// the mirrored counterpart of the last entry, to be returned next
+	mirror bool
+	mi, mj int
+	mv     complex128
+}
+
+// NewReader parses the header, comments, and dimensions from the reader and
+// prepares to read the entries of the matrix.
+func NewReader(rd io.Reader, options ParseOptions) (*Reader, error) {
+	matrix := &Matrix{Options: options}
+	buf := bufio.NewReader(rd)
+
+	if err := matrix.ParseHeader(buf); err != nil {
+		return nil, err
+	}
+
+	if err := matrix.ParseComment(buf); err != nil {
+		return nil, err
+	}
+
+	if err := matrix.ParseDimensions(buf); err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		matrix:  matrix,
+		scanner: matrix.newScanner(buf),
+		row:     arrayStart(0, matrix.Symmetry),
+	}, nil
+}
+
+// Header returns the matrix holding the parsed header information, e.g. the
+// `Format`, `Type`, `Symmetry`, dimensions and comments. The matrix itself is
+// not formed.
+func (r *Reader) Header() *Matrix {
+	return r.matrix
+}
+
+// Next returns the next entry of the matrix as its zero-based index `(i, j)`
+// and its value. Values of `TypePattern` matrices are set to one. After the
+// last entry `io.EOF` is returned. Matrices of `TypeComplex` are read with
+// `NextComplex` instead.
+func (r *Reader) Next() (i, j int, v float64, err error) {
+	if r.matrix.Type == TypeComplex {
+		err := fmt.Errorf("%w: %#v requires NextComplex", ErrUnsupportedType, TypeComplex)
+		return 0, 0, 0, r.matrix.parseError(SectionHeader, "", err)
+	}
+
+	i, j, c, err := r.next()
+	return i, j, real(c), err
+}
+
+// NextComplex returns the next entry of a `TypeComplex` matrix, similar to
+// `Next`.
+func (r *Reader) NextComplex() (i, j int, v complex128, err error) {
+	if r.matrix.Type != TypeComplex {
+		err := fmt.Errorf("%w: expected %#v, got %#v", ErrUnsupportedType, TypeComplex, r.matrix.Type)
+		return 0, 0, 0, r.matrix.parseError(SectionHeader, "", err)
+	}
+	return r.next()
+}
+
+// next returns the pending mirrored entry, or reads the next line.
+func (r *Reader) next() (int, int, complex128, error) {
+	if r.mirror {
+		r.mirror = false
+		return r.mi, r.mj, r.mv, nil
+	}
+
+	for r.scanner.Scan() {
+		r.matrix.line++
+		line := r.scanner.Bytes()
+		if isBlank(line) {
+			continue
+		}
+
+		var i, j int
+		var v complex128
+		var ok bool
+		var err error
+		if r.matrix.Format == FormatArray {
+			i, j, v, err = r.arrayEntry(line)
+			ok = err == nil
+		} else {
+			i, j, v, ok, err = r.coordinateEntry(line)
+		}
+		if err != nil {
+			return 0, 0, 0, r.matrix.parseError(SectionData, string(line), err)
+		}
+		if !ok {
+			continue
+		}
+
+		r.setMirror(i, j, v)
+		return i, j, v, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return 0, 0, 0, r.matrix.scanError(SectionData, err)
+	}
+
+	if r.matrix.Format == FormatArray {
+		if r.entries != r.matrix.lines {
+			err := fmt.Errorf("%w: got %d entries, exp %d", ErrUnexpectedEOF, r.entries, r.matrix.lines)
+			return 0, 0, 0, r.matrix.parseError(SectionData, "", err)
+		}
+	} else if err := r.matrix.checkEntries(r.entries); err != nil {
+		return 0, 0, 0, err
+	}
+	return 0, 0, 0, io.EOF
+}
+
+// coordinateEntry parses a line of a `FormatCoordinate` matrix. It returns
+// whether the entry is valid, or should be skipped in lenient mode.
+func (r *Reader) coordinateEntry(line []byte) (int, int, complex128, bool, error) {
+	var i, j int
+	var v complex128
+	var err error
+	if r.matrix.Type == TypeComplex {
+		i, j, v, err = splitComplexTriplet(string(line))
+	} else {
+		var f float64
+		i, j, f, err = splitEntry(line, r.matrix.Object, r.matrix.Type)
+		v = complex(f, 0)
+	}
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	r.entries++
+	ok, err := r.matrix.checkEntry(r.entries, i, j)
+	if ok {
+		err = r.matrix.checkFinite(v)
+	}
+	return i - 1, j - 1, v, ok && err == nil, err
+}
+
+// arrayEntry parses a line of a `FormatArray` matrix and returns the value with
+// its position in the matrix.
+func (r *Reader) arrayEntry(line []byte) (int, int, complex128, error) {
+	var v complex128
+	if r.matrix.Type == TypeComplex {
+		splits := strings.Fields(string(line))
+		if len(splits) != 2 {
+			return 0, 0, 0, fmt.Errorf("%w: expected real and imaginary part, got %d values", ErrInvalidEntry, len(splits))
+		}
+
+		c, err := splitComplex(splits[0], splits[1])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		v = c
+	} else {
+		f, err := parseValue(bytes.TrimSpace(line), r.matrix.Type)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		v = complex(f, 0)
+	}
+
+	r.entries++
+	if r.entries > r.matrix.lines {
+		return 0, 0, 0, fmt.Errorf("%w: exp %d", ErrTooManyEntries, r.matrix.lines)
+	}
+	if err := r.matrix.checkFinite(v); err != nil {
+		return 0, 0, 0, err
+	}
+
+	// advance the position in column-major order
+	i, j := r.row, r.col
+	r.row++
+	if r.row >= r.matrix.n {
+		r.col++
+		r.row = arrayStart(r.col, r.matrix.Symmetry)
+	}
+	return i, j, v, nil
+}
+
+// setMirror stores the mirrored counterpart of an off-diagonal entry, if the
+// symmetry is to be expanded.
+func (r *Reader) setMirror(i, j int, v complex128) {
+	if !r.ExpandSymmetry || i == j {
+		return
+	}
+
+	switch r.matrix.Symmetry {
+	case Symmetric:
+	case SkewSymmetric:
+		v = -v
+	case Hermitian:
+		v = cmplx.Conj(v)
+	default:
+		return
+	}
+	r.mirror = true
+	r.mi, r.mj, r.mv = j, i, v
+}
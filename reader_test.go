@@ -0,0 +1,192 @@
+package gomm
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// readAll collects all entries of the reader in a dense matrix.
+func readAll(t *testing.T, r *Reader) (*mat.Dense, int) {
+	n, m := r.Header().Dims()
+	dense := mat.NewDense(n, m, nil)
+	cnt := 0
+	for {
+		i, j, v, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		dense.Set(i, j, dense.At(i, j)+v)
+		cnt++
+	}
+	return dense, cnt
+}
+
+func TestReader(t *testing.T) {
+	entries := []struct {
+		str    string
+		expand bool
+		cnt    int
+	}{
+		{
+			str: `%%MatrixMarket matrix coordinate real symmetric
+% stored lower triangle
+3 3 4
+1 1 1.0
+2 1 2.0
+3 1 3.0
+3 3 4.0
+`,
+			cnt: 4,
+		},
+		{
+			str: `%%MatrixMarket matrix coordinate real symmetric
+3 3 4
+1 1 1.0
+2 1 2.0
+3 1 3.0
+3 3 4.0
+`,
+			expand: true,
+			cnt:    6,
+		},
+		{
+			str: `%%MatrixMarket matrix array real symmetric
+3 3
+1.0
+2.0
+3.0
+0.0
+0.0
+4.0
+`,
+			expand: true,
+			cnt:    9,
+		},
+		{
+			str: `%%MatrixMarket matrix coordinate pattern skew-symmetric
+3 3 2
+2 1
+3 2
+`,
+			expand: true,
+			cnt:    4,
+		},
+	}
+
+	for _, e := range entries {
+		r, err := NewReader(strings.NewReader(e.str), ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ExpandSymmetry = e.expand
+
+		dense, cnt := readAll(t, r)
+		if cnt != e.cnt {
+			t.Errorf("Wrong number of entries: exp %d, got %d", e.cnt, cnt)
+		}
+
+		// the expanded entries match the parsed matrix
+		if e.expand {
+			ref, err := (&Matrix{}).Parse(strings.NewReader(e.str))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !mat.Equal(ref, dense) {
+				t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(ref), mat.Formatted(dense))
+			}
+		}
+	}
+}
+
+func TestReaderComplex(t *testing.T) {
+	str := `%%MatrixMarket matrix coordinate complex hermitian
+2 2 2
+1 1 1.0 0.0
+2 1 2.0 3.0
+`
+	r, err := NewReader(strings.NewReader(str), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ExpandSymmetry = true
+
+	if _, _, _, err := r.Next(); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected error %v, got: %v", ErrUnsupportedType, err)
+	}
+
+	exp := []complex128{1, 2 + 3i, 2 - 3i}
+	for k := 0; ; k++ {
+		_, _, v, err := r.NextComplex()
+		if err == io.EOF {
+			if k != len(exp) {
+				t.Errorf("Wrong number of entries: exp %d, got %d", len(exp), k)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k >= len(exp) || v != exp[k] {
+			t.Errorf("Wrong entry %d: got %v", k, v)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	entries := []struct {
+		str string
+		err error
+	}{
+		{
+			str: "%%MatrixMarket matrix coordinate real general\n2 2 3\n1 1 1.0\n2 2 1.0\n",
+			err: ErrUnexpectedEOF,
+		},
+		{
+			str: "%%MatrixMarket matrix coordinate real general\n2 2 1\n1 1 1.0\n2 2 1.0\n",
+			err: ErrTooManyEntries,
+		},
+		{
+			str: "%%MatrixMarket matrix coordinate real general\n2 2 2\n1 1 1.0\n3 2 1.0\n",
+			err: ErrIndexOutOfRange,
+		},
+		{
+			str: "%%MatrixMarket matrix array real general\n2 1\n1.0\n2.0\n3.0\n",
+			err: ErrTooManyEntries,
+		},
+		{
+			str: "%%MatrixMarket matrix array real general\n2 1\n1.0\n",
+			err: ErrUnexpectedEOF,
+		},
+	}
+
+	for _, e := range entries {
+		r, err := NewReader(strings.NewReader(e.str), ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for err == nil {
+			_, _, _, err = r.Next()
+		}
+		if !errors.Is(err, e.err) {
+			t.Errorf("Expected error %v for %q, got: %v", e.err, e.str, err)
+		}
+	}
+
+	// in lenient mode the out of range index is skipped
+	str := "%%MatrixMarket matrix coordinate real general\n2 2 2\n1 1 1.0\n3 2 1.0\n"
+	r, err := NewReader(strings.NewReader(str), ParseOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, cnt := readAll(t, r); cnt != 1 {
+		t.Errorf("Wrong number of entries: exp %d, got %d", 1, cnt)
+	}
+}
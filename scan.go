@@ -0,0 +1,297 @@
+package gomm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"unsafe"
+)
+
+// intDigits is the number of decimal digits that always fit an `int`.
+const intDigits = strconv.IntSize * 18 / 64
+
+// float64pow10 holds the powers of ten that are exactly representable.
+var float64pow10 = [...]float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10,
+	1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20,
+	1e21, 1e22,
+}
+
+// isSpace reports whether the byte is ASCII white space.
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// isBlank reports whether the line holds only white space.
+func isBlank(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
+
+// maxLineLength returns the maximum length of a line of the matrix.
+func (matrix *Matrix) maxLineLength() int {
+	if matrix.Options.MaxLineLength > 0 {
+		return matrix.Options.MaxLineLength
+	}
+	return DefaultMaxLineLength
+}
+
+// lineTooLong returns the error for lines exceeding the maximum length.
+func lineTooLong(max int) error {
+	return fmt.Errorf("%w: exceeds %d bytes", ErrLineTooLong, max)
+}
+
+// readLine reads the next line, including its line ending, similar to
+// `ReadBytes`. Lines exceeding the maximum line length are rejected.
+func (matrix *Matrix) readLine(buf *bufio.Reader) ([]byte, error) {
+	max := matrix.maxLineLength()
+	var line []byte
+	for {
+		b, err := buf.ReadSlice('\n')
+		line = append(line, b...)
+		if len(bytes.TrimRight(line, "\r\n")) > max {
+			return nil, lineTooLong(max)
+		}
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// peekNonSpace returns the first byte that is not white space without
+// consuming it, or the line ending for empty lines.
+func peekNonSpace(buf *bufio.Reader) (byte, error) {
+	for k := 1; ; k++ {
+		b, err := buf.Peek(k)
+		if len(b) < k {
+			return 0, err
+		}
+		if c := b[k-1]; c == '\n' || !isSpace(c) {
+			return c, nil
+		}
+	}
+}
+
+// newScanner returns a scanner over the lines of the data section. The line
+// endings, either LF or CRLF, are dropped, and lines exceeding the maximum
+// line length are rejected.
+func (matrix *Matrix) newScanner(rd io.Reader) *bufio.Scanner {
+	max := matrix.maxLineLength()
+	size := 4096
+	if max+2 < size {
+		size = max + 2
+	}
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, size), max+2)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if len(token) > max {
+			return 0, nil, bufio.ErrTooLong
+		}
+		return advance, token, err
+	})
+	return scanner
+}
+
+// scanError forms the `ParseError` for a failure of the scanner in the given
+// section, which occurs at the line following the last scanned line.
+func (matrix *Matrix) scanError(section string, err error) error {
+	matrix.line++
+	if err == bufio.ErrTooLong {
+		err = lineTooLong(matrix.maxLineLength())
+	}
+	return matrix.parseError(section, "", err)
+}
+
+// nextField returns the first white space separated field of the bytes and
+// the remainder following that field. The field is empty if there is none.
+func nextField(b []byte) (field, rest []byte) {
+	k := 0
+	for k < len(b) && isSpace(b[k]) {
+		k++
+	}
+	b = b[k:]
+
+	k = 0
+	for k < len(b) && !isSpace(b[k]) {
+		k++
+	}
+	return b[:k], b[k:]
+}
+
+// countFields returns the number of white space separated fields.
+func countFields(b []byte) int {
+	n := 0
+	for field, rest := nextField(b); len(field) > 0; field, rest = nextField(rest) {
+		n++
+	}
+	return n
+}
+
+// unsafeString returns the bytes as a string without copying. The string is
+// only valid while the bytes are not modified, so it must not be retained.
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// parseDigits parses a decimal integer of at most the given number of digits,
+// with an optional sign. It returns false for any other input.
+func parseDigits(b []byte, digits int) (int64, bool) {
+	s := b
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if len(s) == 0 || len(s) > digits {
+		return 0, false
+	}
+
+	var n int64
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if b[0] == '-' {
+		n = -n
+	}
+	return n, true
+}
+
+// parseInt parses a decimal integer without allocating. Input that is not
+// handled directly is passed to `strconv.Atoi`, such that the results and
+// errors are identical. Errors retain their input, so these are formed from a
+// copy of the bytes.
+func parseInt(b []byte) (int, error) {
+	if n, ok := parseDigits(b, intDigits); ok {
+		return int(n), nil
+	}
+	if n, err := strconv.Atoi(unsafeString(b)); err == nil {
+		return n, nil
+	}
+	return strconv.Atoi(string(b))
+}
+
+// parseInt64 parses a decimal integer without allocating, similar to
+// `parseInt`, with results and errors identical to `strconv.ParseInt`.
+func parseInt64(b []byte) (int64, error) {
+	if n, ok := parseDigits(b, 18); ok {
+		return n, nil
+	}
+	if n, err := strconv.ParseInt(unsafeString(b), 10, 64); err == nil {
+		return n, nil
+	}
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+// parseFloat parses a floating-point number without allocating. Input that is
+// not handled directly is passed to `strconv.ParseFloat`, similar to
+// `parseInt`. In addition to the formats of `strconv.ParseFloat`, the Fortran
+// exponent notation using `D`, e.g. `1.0D+03`, is accepted.
+func parseFloat(b []byte) (float64, error) {
+	if v, ok := parseDecimal(b); ok {
+		return v, nil
+	}
+	if v, err := strconv.ParseFloat(unsafeString(b), 64); err == nil {
+		return v, nil
+	}
+	if v, ok := parseFortran(b); ok {
+		return v, nil
+	}
+	return strconv.ParseFloat(string(b), 64)
+}
+
+// parseFortran parses a floating-point number using the Fortran `D` exponent
+// notation, by replacing the exponent character. It returns false for any
+// other input.
+func parseFortran(b []byte) (float64, bool) {
+	k := bytes.IndexAny(b, "dD")
+	if k < 1 || len(b) > 64 || (b[k-1] != '.' && (b[k-1] < '0' || b[k-1] > '9')) {
+		return 0, false
+	}
+
+	var buf [64]byte
+	n := copy(buf[:], b)
+	buf[k] = 'e'
+	v, err := strconv.ParseFloat(string(buf[:n]), 64)
+	return v, err == nil
+}
+
+// parseDecimal parses a decimal floating-point number of the form
+// `[+-]digits[.digits][(e|E|d|D)[+-]digits]`. Only numbers that are converted
+// exactly are handled: a mantissa of at most 15 significant digits, scaled by
+// an exactly representable power of ten, is correctly rounded by a single
+// multiplication or division. It returns false for any other input.
+func parseDecimal(b []byte) (float64, bool) {
+	k := 0
+	neg := false
+	if k < len(b) && (b[k] == '+' || b[k] == '-') {
+		neg = b[k] == '-'
+		k++
+	}
+
+	// mantissa, ignoring leading zeros
+	var mant uint64
+	exp, nd := 0, 0
+	digits, dot := false, false
+loop:
+	for ; k < len(b); k++ {
+		c := b[k]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+			if dot {
+				exp--
+			}
+			if mant == 0 && c == '0' {
+				continue
+			}
+			if nd++; nd > 15 {
+				return 0, false
+			}
+			mant = mant*10 + uint64(c-'0')
+		case c == '.' && !dot:
+			dot = true
+		default:
+			break loop
+		}
+	}
+	if !digits {
+		return 0, false
+	}
+
+	// exponent
+	if k < len(b) && (b[k] == 'e' || b[k] == 'E' || b[k] == 'd' || b[k] == 'D') {
+		k++
+		e, ok := parseDigits(b[k:], 4)
+		if !ok {
+			return 0, false
+		}
+		exp += int(e)
+		k = len(b)
+	}
+	if k != len(b) {
+		return 0, false
+	}
+
+	v := float64(mant)
+	switch {
+	case mant == 0:
+	case exp < -len(float64pow10)+1 || exp > len(float64pow10)-1:
+		return 0, false
+	case exp < 0:
+		v /= float64pow10[-exp]
+	default:
+		v *= float64pow10[exp]
+	}
+	if neg {
+		v = -v
+	}
+	return v, true
+}
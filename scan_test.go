@@ -0,0 +1,158 @@
+package gomm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseFloat(t *testing.T) {
+	values := []string{
+		"0", "-0", "+0", "1", "-1", "1.0", "1.", ".5", "0.05", "00.5",
+		"1e5", "1E-5", "-2.5e+10", "1.5e22", "1e23", "1e-22", "1e-23",
+		"123456789012345", "1234567890123456", "0.1234567890123456789",
+		"3.141592653589793", "1e308", "1e309", "4.9e-324", "inf", "-Inf",
+		"NaN", "0x1p-2", "1_0", "", ".", "-", "e5", "1e", "1e+", "1.2.3",
+		"1 2",
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for k := 0; k < 1000; k++ {
+		v := rnd.NormFloat64() * math.Pow(10, float64(rnd.Intn(40)-20))
+		values = append(values,
+			strconv.FormatFloat(v, 'g', -1, 64),
+			strconv.FormatFloat(v, 'e', rnd.Intn(16), 64),
+			strconv.FormatFloat(v, 'f', rnd.Intn(10), 64),
+		)
+	}
+
+	for _, s := range values {
+		exp, expErr := strconv.ParseFloat(s, 64)
+		v, err := parseFloat([]byte(s))
+		if fmt.Sprint(err) != fmt.Sprint(expErr) {
+			t.Errorf("Wrong error for %q: exp %v, got %v", s, expErr, err)
+		}
+		if math.Float64bits(v) != math.Float64bits(exp) && !(math.IsNaN(v) && math.IsNaN(exp)) {
+			t.Errorf("Wrong value for %q: exp %v, got %v", s, exp, v)
+		}
+	}
+}
+
+func TestParseFloatFortran(t *testing.T) {
+	entries := []struct {
+		str string
+		v   float64
+	}{
+		{str: "1.0D+03", v: 1e3},
+		{str: "1.0d-3", v: 1e-3},
+		{str: "-2.5D10", v: -2.5e10},
+		{str: ".5D0", v: 0.5},
+		{str: "1.D2", v: 100},
+		{str: "0.12345678901234567D+05", v: 0.12345678901234567e5},
+	}
+
+	for _, e := range entries {
+		v, err := parseFloat([]byte(e.str))
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", e.str, err)
+		}
+		if v != e.v {
+			t.Errorf("Wrong value for %q: exp %v, got %v", e.str, e.v, v)
+		}
+	}
+
+	// malformed input reports the original input
+	for _, str := range []string{"D5", "1.0D", "1.0DD5", "1.0D+03x"} {
+		_, err := parseFloat([]byte(str))
+		if err == nil || !strings.Contains(err.Error(), strconv.Quote(str)) {
+			t.Errorf("Expected error for %q, got: %v", str, err)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	values := []string{
+		"0", "-0", "+1", "-1", "42", "123456789012345678",
+		"1234567890123456789", "9223372036854775808", "", "-", "1.0",
+		"1e3", "0x10", "1_000",
+	}
+
+	for _, s := range values {
+		exp, expErr := strconv.Atoi(s)
+		v, err := parseInt([]byte(s))
+		if v != exp || fmt.Sprint(err) != fmt.Sprint(expErr) {
+			t.Errorf("Wrong result for %q: exp (%v, %v), got (%v, %v)", s, exp, expErr, v, err)
+		}
+
+		exp64, expErr := strconv.ParseInt(s, 10, 64)
+		v64, err := parseInt64([]byte(s))
+		if v64 != exp64 || fmt.Sprint(err) != fmt.Sprint(expErr) {
+			t.Errorf("Wrong result for %q: exp (%v, %v), got (%v, %v)", s, exp64, expErr, v64, err)
+		}
+	}
+}
+
+func TestSplitTripletAllocs(t *testing.T) {
+	entries := []struct {
+		line string
+		typ  string
+	}{
+		{line: "12 345 -1.2345678e-05", typ: TypeReal},
+		{line: "\t12  345   0.5 ", typ: TypeReal},
+		{line: "12 345 -42", typ: TypeInteger},
+		{line: "12 345", typ: TypePattern},
+	}
+
+	for _, e := range entries {
+		line := []byte(e.line)
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, _, _, err := splitTriplet(line, e.typ); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("Wrong number of allocations for %q: exp 0, got %v", e.line, allocs)
+		}
+	}
+
+	// the number of fields is validated
+	for _, line := range []string{"1 2", "1 2 3 4", ""} {
+		if _, _, _, err := splitTriplet([]byte(line), TypeReal); err == nil {
+			t.Errorf("Expected error for %q", line)
+		}
+	}
+}
+
+func BenchmarkSplitTriplet(b *testing.B) {
+	line := []byte("12345 67890 -1.2345678901234e-05")
+	b.ReportAllocs()
+	for k := 0; k < b.N; k++ {
+		if _, _, _, err := splitTriplet(line, TypeReal); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseArray(b *testing.B) {
+	n := 1000
+	rnd := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%%%%MatrixMarket matrix array real general\n%d %d\n", n, n)
+	for k := 0; k < n*n; k++ {
+		fmt.Fprintf(&buf, "%g\n", rnd.NormFloat64())
+	}
+	data := buf.Bytes()
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for k := 0; k < b.N; k++ {
+		if _, err := (&Matrix{}).Parse(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package gomm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/james-bowman/sparse"
+	"gonum.org/v1/gonum/mat"
+)
+
+// ParseVector parses a vector object of the `MatrixMarket` format from a
+// `Reader`, e.g. a right-hand side or solution, similar to `Parse`. It returns
+// a `*mat.VecDense` for `FormatArray`, or a `*sparse.Vector` for
+// `FormatCoordinate`. Files holding a matrix object are rejected.
+//
+// The header of a vector reads `%%MatrixMarket vector <format> <type>
+// general`. The size line holds the length, followed by the number of entries
+// for `FormatCoordinate`. The entries of `FormatCoordinate` hold the one-based
+// index and the value, those of `FormatArray` only the value.
+func (matrix *Matrix) ParseVector(rd io.Reader) (mat.Vector, error) {
+	buf := bufio.NewReader(rd)
+
+	if err := matrix.ParseHeader(buf); err != nil {
+		return nil, err
+	}
+
+	if matrix.Object != ObjectVector {
+		err := fmt.Errorf("%w: expected %#v, got %#v", ErrUnsupportedObject, ObjectVector, matrix.Object)
+		return nil, matrix.parseError(SectionHeader, "", err)
+	}
+
+	if err := matrix.parseBody(buf); err != nil {
+		return nil, err
+	}
+	return matrix.mat.(mat.Vector), nil
+}
+
+// parseVectorDimensions parses the size line of a vector: its length, and the
+// number of entries for `FormatCoordinate`.
+func (matrix *Matrix) parseVectorDimensions(line string, dims []string) error {
+	if len(dims) < 1 {
+		err := fmt.Errorf("%w: expect at least one value: (n, _), got: %v", ErrInvalidSize, dims)
+		return matrix.parseError(SectionSize, line, err)
+	}
+
+	n, err := strconv.Atoi(dims[0])
+	if err != nil {
+		return matrix.parseError(SectionSize, line, err)
+	}
+	matrix.n, matrix.m = n, 1
+
+	if err := checkDims(n, 1); err != nil {
+		return matrix.parseError(SectionSize, line, err)
+	}
+
+	if matrix.Format == FormatArray {
+		matrix.lines = n
+		return nil
+	}
+
+	if len(dims) < 2 {
+		err := fmt.Errorf("%w: expect at least two values: (n, v), got: %v", ErrInvalidSize, dims)
+		return matrix.parseError(SectionSize, line, err)
+	}
+	lines, err := strconv.Atoi(dims[1])
+	if err != nil {
+		return matrix.parseError(SectionSize, line, err)
+	}
+	if err := checkLines(lines); err != nil {
+		return matrix.parseError(SectionSize, line, err)
+	}
+	matrix.lines = lines
+	return nil
+}
+
+// splitVectorEntry splits an entry of a `FormatCoordinate` vector of (i, v)
+// form into its one-based index and the value of the given value type. Entries
+// of `TypePattern` only hold the index, for these the value is set to one.
+func splitVectorEntry(b []byte, typ string) (i int, v float64, err error) {
+	fields := 2
+	if typ == TypePattern {
+		fields = 1
+	}
+
+	splits, err := splitFields(b, fields)
+	if err != nil {
+		return i, v, err
+	}
+
+	i, err = parseInt(splits[0])
+	if err != nil {
+		return i, v, err
+	}
+
+	if typ == TypePattern {
+		return i, 1.0, nil
+	}
+
+	v, err = parseValue(splits[1], typ)
+	if err != nil {
+		return i, v, err
+	}
+
+	return i, v, nil
+}
+
+// assembleVector forms the sparse vector from the parsed triplets, after
+// combining duplicates.
+func (matrix *Matrix) assembleVector(t *triplets) error {
+	n, _ := matrix.Dims()
+	ind, data := make([]int, 0, len(t.V)), make([]float64, 0, len(t.V))
+	err := matrix.groupEntries(t.I, t.J, t.lines, func(group []int) {
+		v := 0.0
+		for _, k := range matrix.selectEntries(group) {
+			v += t.V[k]
+		}
+
+		// explicit zeros are only inserted on request
+		if v == 0 && matrix.Options.Zeros == DropZeros {
+			return
+		}
+		ind, data = append(ind, t.I[group[0]]), append(data, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	matrix.mat = sparse.NewVector(n, ind, data)
+	matrix.nnz = len(data)
+	return nil
+}
+
+// SaveVectorToMatrixMarket writes a vector to the `MatrixMarket` vector
+// format, see `ParseVector`. Sparse vectors, such as `*sparse.Vector`, are
+// written in `FormatCoordinate`, others in `FormatArray`. The `WithType` and
+// `WithFormat` options are supported, vectors are always written as
+// `General`.
+func SaveVectorToMatrixMarket(vec mat.Vector, wr io.Writer, opts ...WriteOption) error {
+	cfg := writeConfig{typ: TypeReal, symmetry: General}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	switch cfg.typ {
+	case TypeReal, TypeInteger, TypePattern:
+	default:
+		return fmt.Errorf("Unsupported type for writing: %v", cfg.typ)
+	}
+	if cfg.symmetry != General {
+		return fmt.Errorf("Symmetry %#v is not supported for vectors", cfg.symmetry)
+	}
+
+	// select the representation that is written
+	sp, isSparse := nonZeros(vec)
+	switch cfg.format {
+	case "":
+		cfg.format = FormatArray
+		if isSparse {
+			cfg.format = FormatCoordinate
+		}
+	case FormatCoordinate:
+		if !isSparse {
+			sp = denseNonZeros{vec}
+		}
+	case FormatArray:
+	default:
+		return fmt.Errorf("Unsupported format for writing: %v", cfg.format)
+	}
+
+	// buffered output
+	buf := bufio.NewWriter(wr)
+
+	if cfg.format == FormatCoordinate {
+		return writeVectorCoordinate(buf, vec.Len(), sp, cfg)
+	}
+	return writeVectorArray(buf, vec, cfg)
+}
+
+// writeVectorCoordinate writes the stored entries of a sparse vector of the
+// given length in `FormatCoordinate`.
+func writeVectorCoordinate(buf *bufio.Writer, n int, vec sparseMatrix, cfg writeConfig) error {
+	// verify all values can be represented before writing any output
+	var invalid error
+	lines := 0
+	vec.DoNonZero(func(i, _ int, v float64) {
+		lines++
+		if _, err := formatValue(v, cfg.typ); err != nil && invalid == nil {
+			invalid = fmt.Errorf("Entry (%d): %w", i+1, err)
+		}
+	})
+	if invalid != nil {
+		return invalid
+	}
+
+	header := fmt.Sprintf("%%%%MatrixMarket vector %s %s %s\n", FormatCoordinate, cfg.typ, General)
+	if _, err := buf.WriteString(header); err != nil {
+		return err
+	}
+
+	// Vector length and number of lines of output
+	if _, err := buf.WriteString(fmt.Sprintf("%d %d\n", n, lines)); err != nil {
+		return err
+	}
+
+	var err error
+	vec.DoNonZero(func(i, _ int, v float64) {
+		if err != nil {
+			return
+		}
+
+		// Correct for one-base; values are verified above
+		line := fmt.Sprintf("%d\n", i+1)
+		if cfg.typ != TypePattern {
+			s, _ := formatValue(v, cfg.typ)
+			line = fmt.Sprintf("%d %s\n", i+1, s)
+		}
+		if _, werr := buf.WriteString(line); werr != nil {
+			err = fmt.Errorf("Error in writing entry (%d): %w", i+1, werr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return buf.Flush()
+}
+
+// writeVectorArray writes all values of the vector in `FormatArray`.
+func writeVectorArray(buf *bufio.Writer, vec mat.Vector, cfg writeConfig) error {
+	if cfg.typ == TypePattern {
+		return fmt.Errorf("Type %#v is not supported for format %#v", TypePattern, FormatArray)
+	}
+
+	header := fmt.Sprintf("%%%%MatrixMarket vector %s %s %s\n", FormatArray, cfg.typ, General)
+	if _, err := buf.WriteString(header); err != nil {
+		return err
+	}
+
+	// Vector length
+	n := vec.Len()
+	if _, err := buf.WriteString(fmt.Sprintf("%d\n", n)); err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		s, err := formatValue(vec.AtVec(i), cfg.typ)
+		if err != nil {
+			return fmt.Errorf("Entry (%d): %w", i+1, err)
+		}
+		if _, err := buf.WriteString(s + "\n"); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
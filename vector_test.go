@@ -0,0 +1,149 @@
+package gomm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/james-bowman/sparse"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestParseVector(t *testing.T) {
+	entries := []struct {
+		str string
+		exp []float64
+		nnz int
+	}{
+		{
+			str: "%%MatrixMarket vector array real general\n% rhs\n3\n1.0\n-2.0\n3.5\n",
+			exp: []float64{1, -2, 3.5},
+		},
+		{
+			str: "%%MatrixMarket vector coordinate real general\n4 3\n4 1.5\n1 2.0\n4 0.5\n",
+			exp: []float64{2, 0, 0, 2},
+			nnz: 2,
+		},
+		{
+			str: "%%MatrixMarket vector coordinate integer general\n3 1\n2 7\n",
+			exp: []float64{0, 7, 0},
+			nnz: 1,
+		},
+		{
+			str: "%%MatrixMarket vector coordinate pattern general\n3 2\n1\n3\n",
+			exp: []float64{1, 0, 1},
+			nnz: 2,
+		},
+	}
+
+	for _, e := range entries {
+		matrix := &Matrix{}
+		vec, err := matrix.ParseVector(strings.NewReader(e.str))
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", e.str, err)
+		}
+		if !mat.Equal(vec, mat.NewVecDense(len(e.exp), e.exp)) {
+			t.Errorf("Wrong content: exp %v, got %v", e.exp, mat.Formatted(vec.T()))
+		}
+
+		_, isSparse := vec.(*sparse.Vector)
+		if isSparse != (matrix.Format == FormatCoordinate) {
+			t.Errorf("Wrong vector type for format %#v: %T", matrix.Format, vec)
+		}
+		if isSparse && matrix.NNZ() != e.nnz {
+			t.Errorf("Wrong number of non-zero entries: exp %d, got %d", e.nnz, matrix.NNZ())
+		}
+
+		// parsed as matrix it forms a single column
+		smat, err := (&Matrix{}).Parse(strings.NewReader(e.str))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, m := smat.Dims(); n != len(e.exp) || m != 1 {
+			t.Errorf("Wrong dimensions: exp (%d, 1), got (%d, %d)", len(e.exp), n, m)
+		}
+
+		// the streaming reader returns the entries in the first column
+		r, err := NewReader(strings.NewReader(e.str), ParseOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dense, _ := readAll(t, r); !mat.Equal(dense, vec) {
+			t.Errorf("Wrong content: exp %v, got %v", e.exp, mat.Formatted(dense))
+		}
+	}
+}
+
+func TestParseVectorErrors(t *testing.T) {
+	entries := []struct {
+		str string
+		err error
+	}{
+		{str: "%%MatrixMarket matrix array real general\n2 1\n1.0\n2.0\n", err: ErrUnsupportedObject},
+		{str: "%%MatrixMarket tensor array real general\n2\n1.0\n2.0\n", err: ErrUnsupportedObject},
+		{str: "%%MatrixMarket vector array complex general\n1\n1.0 0.0\n", err: ErrUnsupportedType},
+		{str: "%%MatrixMarket vector array real symmetric\n1\n1.0\n", err: ErrUnsupportedSymmetry},
+		{str: "%%MatrixMarket vector coordinate real general\n2\n1 1.0\n", err: ErrInvalidSize},
+		{str: "%%MatrixMarket vector array real general\n-3\n1.0\n", err: ErrInvalidSize},
+		{str: "%%MatrixMarket vector coordinate real general\n-3 1\n1 1.0\n", err: ErrInvalidSize},
+		{str: "%%MatrixMarket vector coordinate real general\n3 -1\n1 1.0\n", err: ErrInvalidSize},
+		{str: "%%MatrixMarket vector coordinate real general\n2 1\n3 1.0\n", err: ErrIndexOutOfRange},
+		{str: "%%MatrixMarket vector coordinate real general\n2 1\n1 1 1.0\n", err: ErrInvalidEntry},
+		{str: "%%MatrixMarket vector array real general\n2\n1.0\n", err: ErrUnexpectedEOF},
+	}
+
+	for _, e := range entries {
+		_, err := (&Matrix{}).ParseVector(strings.NewReader(e.str))
+		if !errors.Is(err, e.err) {
+			t.Errorf("Expected error %v for %q, got: %v", e.err, e.str, err)
+		}
+	}
+}
+
+func TestWriteVector(t *testing.T) {
+	entries := []struct {
+		vec    mat.Vector
+		opts   []WriteOption
+		format string
+	}{
+		{vec: mat.NewVecDense(3, []float64{1.5, 0, -2}), format: FormatArray},
+		{vec: sparse.NewVector(5, []int{1, 4}, []float64{2, -3.25}), format: FormatCoordinate},
+		{vec: mat.NewVecDense(3, []float64{1.5, 0, -2}), opts: []WriteOption{WithFormat(FormatCoordinate)}, format: FormatCoordinate},
+		{vec: mat.NewVecDense(2, []float64{3, -4}), opts: []WriteOption{WithType(TypeInteger)}, format: FormatArray},
+	}
+
+	for _, e := range entries {
+		var buf bytes.Buffer
+		if err := SaveVectorToMatrixMarket(e.vec, &buf, e.opts...); err != nil {
+			t.Fatal(err)
+		}
+		str := buf.String()
+
+		matrix := &Matrix{}
+		vec, err := matrix.ParseVector(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", str, err)
+		}
+		if matrix.Format != e.format {
+			t.Errorf("Wrong format: exp %#v, got %#v", e.format, matrix.Format)
+		}
+		if !mat.Equal(e.vec, vec) {
+			t.Errorf("Wrong content: exp %v, got %v", mat.Formatted(e.vec.T()), mat.Formatted(vec.T()))
+		}
+	}
+
+	// unsupported options
+	vec := mat.NewVecDense(2, []float64{1.5, 2})
+	opts := [][]WriteOption{
+		{WithSymmetry(Symmetric)},
+		{WithType(TypeInteger)},
+		{WithType(TypePattern)},
+		{WithType(TypeComplex)},
+	}
+	for _, opt := range opts {
+		if err := SaveVectorToMatrixMarket(vec, &bytes.Buffer{}, opt...); err == nil {
+			t.Errorf("Expected error for options %v", opt)
+		}
+	}
+}